@@ -0,0 +1,313 @@
+package kvs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Permission categories a Grant can hold. Read, write and admin say what
+// may be done; string and skiplist narrow a grant down to one kind of
+// data. A grant with neither applies to both.
+const (
+	PermRead     = "read"
+	PermWrite    = "write"
+	PermAdmin    = "admin"
+	PermString   = "string"
+	PermSkipList = "skiplist"
+)
+
+// AllDomains in a Grant matches every domain.
+const AllDomains = "*"
+
+var (
+	errPermissionDenied = errors.New("permission denied")
+	errACLDisabled      = errors.New("access control is not enabled")
+)
+
+// Grant gives permissions on one domain, or on all of them.
+type Grant struct {
+	Domain      string   `json:"domain" yaml:"domain"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// Role is a named set of grants.
+type Role struct {
+	Name   string  `json:"name" yaml:"name"`
+	Grants []Grant `json:"grants" yaml:"grants"`
+}
+
+// ACLInfo lists the roles of an ACL and the roles of each user.
+type ACLInfo struct {
+	Roles []Role              `json:"roles"`
+	Users map[string][]string `json:"users"`
+}
+
+// kind is what an action does and to which data, for permission checks.
+type kind struct {
+	perm  string
+	types []string
+}
+
+var (
+	bothTypes    = []string{PermString, PermSkipList}
+	stringType   = []string{PermString}
+	skipListType = []string{PermSkipList}
+)
+
+// actionKinds classifies every data and admin action. Actions that are not
+// listed are denied to everyone.
+var actionKinds = map[string]kind{
+	"get_string":  {PermRead, stringType},
+	"getrange":    {PermRead, stringType},
+	"strlen":      {PermRead, stringType},
+	"mget":        {PermRead, stringType},
+	"scan_prefix": {PermRead, stringType},
+	"scan_range":  {PermRead, stringType},
+
+	"set_string":  {PermWrite, stringType},
+	"append":      {PermWrite, stringType},
+	"setrange":    {PermWrite, stringType},
+	"getset":      {PermWrite, stringType},
+	"getdel":      {PermWrite, stringType},
+	"mset":        {PermWrite, stringType},
+	"msetnx":      {PermWrite, stringType},
+	"increment":   {PermWrite, stringType},
+	"decrement":   {PermWrite, stringType},
+	"incrby":      {PermWrite, stringType},
+	"decrby":      {PermWrite, stringType},
+	"incrbyfloat": {PermWrite, stringType},
+
+	"search_skiplist": {PermRead, skipListType},
+	"rank_skiplist":   {PermRead, skipListType},
+
+	"insert_skiplist":            {PermWrite, skipListType},
+	"delete_skiplist":            {PermWrite, skipListType},
+	"delete_range_skiplist":      {PermWrite, skipListType},
+	"delete_rank_range_skiplist": {PermWrite, skipListType},
+
+	"exists":        {PermRead, bothTypes},
+	"type":          {PermRead, bothTypes},
+	"scan":          {PermRead, bothTypes},
+	"export_domain": {PermRead, bothTypes},
+
+	"del":           {PermWrite, bothTypes},
+	"rename":        {PermWrite, bothTypes},
+	"renamenx":      {PermWrite, bothTypes},
+	"copy":          {PermWrite, bothTypes},
+	"import_domain": {PermWrite, bothTypes},
+
+	"create_domain": {PermAdmin, nil},
+	"clone_domain":  {PermAdmin, nil},
+	"set_limits":    {PermAdmin, nil},
+	"get_limits":    {PermAdmin, nil},
+	"config_memory": {PermAdmin, nil},
+	"memory_stats":  {PermAdmin, nil},
+
+	// The debug dump shows the internals of a list, not just its data.
+	"debug_skiplist": {PermAdmin, nil},
+}
+
+// ACL maps users to roles and roles to per-domain permissions. It is safe
+// for concurrent use, so it can be changed while a Server uses it.
+type ACL struct {
+	mu    sync.RWMutex
+	roles map[string]Role
+	users map[string][]string
+}
+
+func NewACL() *ACL {
+	return &ACL{
+		roles: make(map[string]Role),
+		users: make(map[string][]string),
+	}
+}
+
+// SetRole adds role or replaces the role of the same name.
+func (a *ACL) SetRole(role Role) error {
+	if role.Name == "" {
+		return fmt.Errorf("role name is required")
+	}
+	for _, grant := range role.Grants {
+		if grant.Domain == "" {
+			return fmt.Errorf("grants need a domain")
+		}
+		for _, perm := range grant.Permissions {
+			switch perm {
+			case PermRead, PermWrite, PermAdmin, PermString, PermSkipList:
+			default:
+				return fmt.Errorf("unknown permission %q", perm)
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.roles[role.Name] = role
+	return nil
+}
+
+// DeleteRole removes a role. Users keep its name but it grants nothing.
+func (a *ACL) DeleteRole(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.roles, name)
+}
+
+// SetUser replaces the roles of user. Roles need not exist yet.
+func (a *ACL) SetUser(user string, roles []string) error {
+	if user == "" {
+		return fmt.Errorf("user name is required")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[user] = slices.Clone(roles)
+	return nil
+}
+
+// DeleteUser removes every role of user.
+func (a *ACL) DeleteUser(user string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.users, user)
+}
+
+// Info returns the roles, sorted by name, and the roles of every user.
+func (a *ACL) Info() *ACLInfo {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	info := &ACLInfo{Roles: make([]Role, 0, len(a.roles)), Users: make(map[string][]string, len(a.users))}
+	for _, role := range a.roles {
+		info.Roles = append(info.Roles, role)
+	}
+	sort.Slice(info.Roles, func(i, j int) bool { return info.Roles[i].Name < info.Roles[j].Name })
+	for user, roles := range a.users {
+		info.Users[user] = slices.Clone(roles)
+	}
+	return info
+}
+
+// Allowed reports whether user may perform action on domain. Actions
+// missing from actionKinds are never allowed.
+func (a *ACL) Allowed(user, action, domain string) bool {
+	k, ok := actionKinds[action]
+	if !ok {
+		return false
+	}
+	return a.allowed(user, k, domain)
+}
+
+func (a *ACL) allowed(user string, k kind, domain string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	// Grants may be split across roles, so collect the types covered by
+	// every grant holding the needed permission.
+	covered := make(map[string]bool)
+	for _, name := range a.users[user] {
+		for _, grant := range a.roles[name].Grants {
+			if grant.Domain != domain && grant.Domain != AllDomains {
+				continue
+			}
+			if !slices.Contains(grant.Permissions, k.perm) {
+				continue
+			}
+			types := bothTypes
+			if slices.Contains(grant.Permissions, PermString) || slices.Contains(grant.Permissions, PermSkipList) {
+				types = nil
+				for _, t := range bothTypes {
+					if slices.Contains(grant.Permissions, t) {
+						types = append(types, t)
+					}
+				}
+			}
+			for _, t := range types {
+				covered[t] = true
+			}
+			if len(k.types) == 0 {
+				return true
+			}
+		}
+	}
+	if len(k.types) == 0 {
+		return false
+	}
+	for _, t := range k.types {
+		if !covered[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// WithACL checks every request against acl before running it. Clients
+// must authenticate, see WithAuthTokens, and the acl_* actions let users
+// with admin permission on all domains change acl at runtime.
+func WithACL(acl *ACL) ServerOption {
+	return func(s *Server) {
+		s.acl = acl
+	}
+}
+
+// authorize checks a request of user against the server's ACL, if any.
+func (s *Server) authorize(user string, req Request) error {
+	if s.acl == nil {
+		return nil
+	}
+	if !s.acl.Allowed(user, req.Action, req.Domain) {
+		return errPermissionDenied
+	}
+	switch req.Action {
+	case "create_domain":
+		// Creating a domain that exists replaces it and drops its data,
+		// which only admins of every domain may do.
+		if _, err := s.store.lookupDomain(req.Domain); err == nil && !s.acl.allowed(user, kind{perm: PermAdmin}, AllDomains) {
+			return errPermissionDenied
+		}
+	case "clone_domain":
+		// A clone also writes to the new domain.
+		if !s.acl.Allowed(user, req.Action, req.NewDomain) || !s.acl.Allowed(user, "export_domain", req.Domain) {
+			return errPermissionDenied
+		}
+	}
+	return nil
+}
+
+// handleACL performs the acl_* actions: acl_list, acl_set_role with a role,
+// acl_delete_role with the names in roles, acl_set_user with a user and
+// its roles, and acl_delete_user with a user.
+func (s *Server) handleACL(user string, req Request) Response {
+	if s.acl == nil {
+		return errorResponse(errACLDisabled)
+	}
+	if !s.acl.allowed(user, kind{perm: PermAdmin}, AllDomains) {
+		return errorResponse(errPermissionDenied)
+	}
+
+	var err error
+	switch req.Action {
+	case "acl_list":
+		return Response{Status: "success", ACL: s.acl.Info()}
+	case "acl_set_role":
+		if req.Role == nil {
+			err = fmt.Errorf("role is required")
+		} else {
+			err = s.acl.SetRole(*req.Role)
+		}
+	case "acl_delete_role":
+		for _, name := range req.Roles {
+			s.acl.DeleteRole(name)
+		}
+	case "acl_set_user":
+		err = s.acl.SetUser(req.User, req.Roles)
+	case "acl_delete_user":
+		s.acl.DeleteUser(req.User)
+	default:
+		err = errUnknownAction
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+	return Response{Status: "success"}
+}
@@ -0,0 +1,136 @@
+package kvs
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACL(t *testing.T) {
+	acl := NewACL()
+	assert.NoError(t, acl.SetRole(Role{Name: "admin", Grants: []Grant{{Domain: AllDomains, Permissions: []string{PermRead, PermWrite, PermAdmin}}}}))
+	assert.NoError(t, acl.SetRole(Role{Name: "ranks", Grants: []Grant{{Domain: "lb", Permissions: []string{PermRead, PermSkipList}}}}))
+	assert.NoError(t, acl.SetRole(Role{Name: "strings", Grants: []Grant{{Domain: "lb", Permissions: []string{PermRead, PermWrite, PermString}}}}))
+	assert.NoError(t, acl.SetRole(Role{Name: "owner", Grants: []Grant{{Domain: "lb", Permissions: []string{PermRead, PermWrite, PermAdmin}}}}))
+	assert.EqualError(t, acl.SetRole(Role{Name: "bad", Grants: []Grant{{Domain: "lb", Permissions: []string{"delete"}}}}), `unknown permission "delete"`)
+	assert.NoError(t, acl.SetUser("root", []string{"admin"}))
+	assert.NoError(t, acl.SetUser("bob", []string{"ranks"}))
+	assert.NoError(t, acl.SetUser("carol", []string{"ranks", "strings"}))
+	assert.NoError(t, acl.SetUser("dave", []string{"owner"}))
+
+	for _, c := range []struct {
+		user, action, domain string
+		allowed              bool
+	}{
+		{"root", "create_domain", "any", true},
+		{"root", "del", "any", true},
+		{"bob", "rank_skiplist", "lb", true},
+		{"bob", "rank_skiplist", "other", false},
+		{"bob", "insert_skiplist", "lb", false},
+		{"bob", "get_string", "lb", false},
+		{"bob", "scan", "lb", false},
+		// Grants from several roles add up
+		{"carol", "scan", "lb", true},
+		{"carol", "set_string", "lb", true},
+		{"carol", "del", "lb", false},
+		{"carol", "memory_stats", "lb", false},
+		{"carol", "debug_skiplist", "lb", false},
+		{"dave", "debug_skiplist", "lb", true},
+		// Actions nobody classified are denied, even to admins
+		{"root", "unclassified", "any", false},
+		{"nobody", "get_string", "lb", false},
+	} {
+		assert.Equal(t, c.allowed, acl.Allowed(c.user, c.action, c.domain), "%s %s %s", c.user, c.action, c.domain)
+	}
+
+	server, err := StartServer("ws://127.0.0.1:0/kvs",
+		WithAuthTokens(map[string]string{"root-token": "root", "bob-token": "bob", "dave-token": "dave"}),
+		WithACL(acl))
+	assert.NoError(t, err)
+	defer server.CloseServer()
+	url := "ws://" + server.Addr().String() + "/kvs"
+	dial := func(token string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+		assert.NoError(t, err)
+		return conn
+	}
+	send := func(conn *websocket.Conn, req Request) Response {
+		assert.NoError(t, conn.WriteJSON(req))
+		var resp Response
+		assert.NoError(t, conn.ReadJSON(&resp))
+		return resp
+	}
+	root, bob, dave := dial("root-token"), dial("bob-token"), dial("dave-token")
+	defer root.Close()
+	defer bob.Close()
+	defer dave.Close()
+
+	// Admins of one domain may create it but not replace it once it exists
+	assert.Equal(t, "success", send(dave, Request{Action: "create_domain", Domain: "lb"}).Status)
+	assert.Equal(t, "success", send(dave, Request{Action: "set_string", Domain: "lb", Key: "k", Value: "v"}).Status)
+	assert.Equal(t, "permission denied", send(dave, Request{Action: "create_domain", Domain: "lb"}).Message)
+	assert.Equal(t, "v", send(dave, Request{Action: "get_string", Domain: "lb", Key: "k"}).Value)
+	assert.Equal(t, "success", send(root, Request{Action: "create_domain", Domain: "lb"}).Status)
+	assert.Equal(t, "success", send(root, Request{Action: "insert_skiplist", Domain: "lb", SLKey: "l", Key: "1", Value: "one"}).Status)
+	assert.Equal(t, "0", send(bob, Request{Action: "rank_skiplist", Domain: "lb", SLKey: "l", Key: "1"}).Value)
+	assert.Equal(t, "permission denied", send(bob, Request{Action: "insert_skiplist", Domain: "lb", SLKey: "l", Key: "2", Value: "two"}).Message)
+	assert.Equal(t, "permission denied", send(bob, Request{Action: "clone_domain", Domain: "lb", NewDomain: "copy"}).Message)
+
+	// Only admins of every domain manage the ACL, at runtime
+	assert.Equal(t, "permission denied", send(bob, Request{Action: "acl_list"}).Message)
+	assert.Equal(t, "success", send(root, Request{Action: "acl_set_role", Role: &Role{
+		Name: "writer", Grants: []Grant{{Domain: "lb", Permissions: []string{PermWrite}}}}}).Status)
+	assert.Equal(t, "success", send(root, Request{Action: "acl_set_user", User: "bob", Roles: []string{"ranks", "writer"}}).Status)
+	assert.Equal(t, "success", send(bob, Request{Action: "insert_skiplist", Domain: "lb", SLKey: "l", Key: "2", Value: "two"}).Status)
+	info := send(root, Request{Action: "acl_list"}).ACL
+	assert.Equal(t, []string{"ranks", "writer"}, info.Users["bob"])
+	assert.Len(t, info.Roles, 5)
+	assert.Equal(t, "success", send(root, Request{Action: "acl_delete_role", Roles: []string{"writer"}}).Status)
+	assert.Equal(t, "permission denied", send(bob, Request{Action: "del", Domain: "lb", Keys: []string{"l"}}).Message)
+
+	// The export endpoint checks the ACL too
+	req, _ := http.NewRequest("GET", "http://"+server.Addr().String()+"/kvs/export?domain=other", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+// TestActionsClassified fails when handleRequest gains an action that
+// actionKinds does not classify, which the ACL would deny to everyone.
+func TestActionsClassified(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "store.go", nil, 0)
+	assert.NoError(t, err)
+	var actions []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "handleRequest" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			clause, ok := n.(*ast.CaseClause)
+			if !ok {
+				return true
+			}
+			for _, expr := range clause.List {
+				if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					action, _ := strconv.Unquote(lit.Value)
+					actions = append(actions, action)
+				}
+			}
+			return true
+		})
+	}
+	assert.NotEmpty(t, actions)
+	for _, action := range actions {
+		_, ok := actionKinds[action]
+		assert.True(t, ok, "action %q is missing from actionKinds", action)
+	}
+}
@@ -0,0 +1,141 @@
+package kvs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errAuthRequired = errors.New("authentication required")
+	errInvalidToken = errors.New("invalid token")
+	errAuthDisabled = errors.New("authentication is not enabled")
+)
+
+// tokenSet maps bearer tokens to the users they authenticate. Tokens are
+// kept hashed so a lookup takes the same time whatever prefix of a valid
+// token the caller guessed.
+type tokenSet map[[sha256.Size]byte]string
+
+func newTokenSet(tokens map[string]string) tokenSet {
+	set := make(tokenSet, len(tokens))
+	for token, user := range tokens {
+		set[sha256.Sum256([]byte(token))] = user
+	}
+	return set
+}
+
+func (set tokenSet) lookup(token string) (string, bool) {
+	user, ok := set[sha256.Sum256([]byte(token))]
+	return user, ok
+}
+
+// WithAuthTokens requires clients to authenticate. tokens maps each bearer
+// token to the user it authenticates. A client authenticates with an
+// "Authorization: Bearer <token>" header on the upgrade request, with an
+// auth action carrying the token, or with a client certificate verified
+// against the CAs given to WithClientCA, which authenticates the user named
+// by ClientIdentity. Until then every other action is refused.
+func WithAuthTokens(tokens map[string]string) ServerOption {
+	return func(s *Server) {
+		s.tokens = newTokenSet(tokens)
+	}
+}
+
+// authRequired reports whether clients must authenticate, which they must
+// for tokens or an ACL to mean anything.
+func (s *Server) authRequired() bool {
+	return s.tokens != nil || s.acl != nil
+}
+
+// authenticate returns the user the credentials of an HTTP request
+// authenticate, or "" if it carries none.
+func (s *Server) authenticate(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return "", errInvalidToken
+		}
+		user, ok := s.tokens.lookup(token)
+		if !ok {
+			return "", errInvalidToken
+		}
+		return user, nil
+	}
+	return ClientIdentity(r), nil
+}
+
+// requireAuth wraps the HTTP handler of action, which names its domain in
+// the query, to refuse requests without valid credentials or permission.
+func (s *Server) requireAuth(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authRequired() {
+			user, err := s.authenticate(r)
+			if err == nil && user == "" {
+				err = errAuthRequired
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			req := Request{Action: action, Domain: r.URL.Query().Get("domain")}
+			if err := s.authorize(user, req); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err := s.userLimiter(user).take("user"); err != nil {
+				retryAfter := err.(*RateLimitError).RetryAfter
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// session is the state of one websocket connection.
+type session struct {
+	server  *Server
+	user    string
+	limiter *tokenBucket
+}
+
+// handle performs a request on behalf of the session's client, answering
+// auth actions itself and refusing everything else until the client has
+// authenticated. Refused requests cost nothing; auth actions count against
+// the connection's rate limit and all other requests against both the
+// connection's and the user's.
+func (c *session) handle(req Request) Response {
+	if req.Action != "auth" && c.server.authRequired() && c.user == "" {
+		return errorResponse(errAuthRequired)
+	}
+	if err := c.limiter.take("connection"); err != nil {
+		return errorResponse(err)
+	}
+	if req.Action == "auth" {
+		if !c.server.authRequired() {
+			return errorResponse(errAuthDisabled)
+		}
+		user, ok := c.server.tokens.lookup(req.Token)
+		if !ok {
+			return errorResponse(errInvalidToken)
+		}
+		c.user = user
+		return Response{Status: "success", Value: user}
+	}
+	if err := c.server.userLimiter(c.user).take("user"); err != nil {
+		return errorResponse(err)
+	}
+	if strings.HasPrefix(req.Action, "acl_") {
+		return c.server.handleACL(c.user, req)
+	}
+	if err := c.server.authorize(c.user, req); err != nil {
+		return errorResponse(err)
+	}
+	return c.server.store.handleRequest(req)
+}
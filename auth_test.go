@@ -0,0 +1,57 @@
+package kvs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthentication(t *testing.T) {
+	server, err := StartServer("ws://127.0.0.1:0/kvs", WithAuthTokens(map[string]string{"s3cret": "alice"}))
+	assert.NoError(t, err)
+	defer server.CloseServer()
+	server.Store().CreateDomain("test_domain")
+	url := "ws://" + server.Addr().String() + "/kvs"
+
+	send := func(conn *websocket.Conn, req Request) Response {
+		assert.NoError(t, conn.WriteJSON(req))
+		var resp Response
+		assert.NoError(t, conn.ReadJSON(&resp))
+		return resp
+	}
+	get := Request{Action: "get_string", Domain: "test_domain", Key: "k"}
+
+	// Without credentials only auth is accepted
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, Response{Status: "error", Message: "authentication required"}, send(conn, get))
+	assert.Equal(t, Response{Status: "error", Message: "invalid token"}, send(conn, Request{Action: "auth", Token: "guess"}))
+	assert.Equal(t, Response{Status: "success", Value: "alice"}, send(conn, Request{Action: "auth", Token: "s3cret"}))
+	assert.Equal(t, "key not found", send(conn, get).Message)
+
+	// A bearer token on the upgrade request authenticates right away
+	conn2, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer s3cret"}})
+	assert.NoError(t, err)
+	defer conn2.Close()
+	assert.Equal(t, "key not found", send(conn2, get).Message)
+
+	_, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer guess"}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// The HTTP endpoints take the same credentials
+	exportURL := "http://" + server.Addr().String() + "/kvs/export?domain=test_domain"
+	res, err = http.Get(exportURL)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	req, _ := http.NewRequest("GET", exportURL, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
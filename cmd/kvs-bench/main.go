@@ -0,0 +1,253 @@
+// Command kvs-bench drives load against a kvs-server and reports throughput
+// and latency percentiles per operation.
+//
+// Usage:
+//
+//	kvs-bench [-url ws://localhost:8080/ws] [-conns 10] [-duration 10s]
+//	          [-mix set_string=20,get_string=80] [-dist zipfian] [flags]
+//
+// Each connection sends one request at a time and waits for its response,
+// so -conns is also the number of requests in flight. Before measuring, the
+// benchmark creates its domain and fills every string key and skip list so
+// reads hit; skip lists keep growing as insert_skiplist runs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pauljubcse/kvs"
+)
+
+type config struct {
+	url          string
+	token        string
+	domain       string
+	conns        int
+	duration     time.Duration
+	requests     int
+	mix          *mix
+	dist         string
+	zipfS        float64
+	keys         int
+	skipLists    int
+	skipListSize int
+	value        string
+	seed         int64
+}
+
+type worker struct {
+	cfg   *config
+	conn  *websocket.Conn
+	rand  *rand.Rand
+	keys  keyChooser
+	lists keyChooser
+	stats map[string]*stats
+}
+
+func main() {
+	cfg := &config{}
+	var mixSpec string
+	var valueSize int
+	var preload bool
+	flag.StringVar(&cfg.url, "url", "ws://localhost:8080/ws", "websocket URL of the server")
+	flag.StringVar(&cfg.token, "token", os.Getenv("KVS_TOKEN"), "bearer token to authenticate with (default $KVS_TOKEN)")
+	flag.StringVar(&cfg.domain, "domain", "bench", "domain to run in; it is recreated, losing its data")
+	flag.IntVar(&cfg.conns, "conns", 10, "number of connections")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to run")
+	flag.IntVar(&cfg.requests, "requests", 0, "total requests to send instead of running for -duration")
+	flag.StringVar(&mixSpec, "mix", "set_string=20,get_string=80", "weighted operations: "+strings.Join(operationNames(), ", "))
+	flag.StringVar(&cfg.dist, "dist", "uniform", "key distribution: uniform or zipfian")
+	flag.Float64Var(&cfg.zipfS, "zipf-s", 1.1, "exponent of the zipfian distribution, greater than 1")
+	flag.IntVar(&cfg.keys, "keys", 10000, "number of distinct string keys")
+	flag.IntVar(&cfg.skipLists, "skiplists", 10, "number of skip lists")
+	flag.IntVar(&cfg.skipListSize, "skiplist-size", 1000, "elements per skip list, and the range of their keys")
+	flag.IntVar(&valueSize, "value-size", 64, "size of written values in bytes")
+	flag.Int64Var(&cfg.seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.BoolVar(&preload, "preload", true, "fill the domain before measuring")
+	flag.Parse()
+
+	var err error
+	if cfg.mix, err = parseMix(mixSpec); err != nil {
+		fail(err)
+	}
+	if cfg.conns < 1 || cfg.keys < 1 || cfg.skipLists < 1 || cfg.skipListSize < 1 || valueSize < 0 {
+		fail(fmt.Errorf("-conns, -keys, -skiplists and -skiplist-size must be positive"))
+	}
+	cfg.value = strings.Repeat("x", valueSize)
+
+	if err := setup(cfg, preload); err != nil {
+		fail(err)
+	}
+
+	workers := make([]*worker, cfg.conns)
+	for i := range workers {
+		if workers[i], err = newWorker(cfg, cfg.seed+int64(i)); err != nil {
+			fail(err)
+		}
+		defer workers[i].conn.Close()
+	}
+
+	fmt.Printf("%d connections, %s keys, mix %s\n", cfg.conns, cfg.dist, mixSpec)
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+	for i, w := range workers {
+		n := -1
+		if cfg.requests > 0 {
+			n = cfg.requests / cfg.conns
+			if i < cfg.requests%cfg.conns {
+				n++
+			}
+		}
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			if err := w.run(deadline, n); err != nil {
+				fmt.Fprintf(os.Stderr, "kvs-bench: %v\n", err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := &stats{}
+	printHeader(os.Stdout)
+	for _, op := range operationNames() {
+		s := &stats{}
+		for _, w := range workers {
+			if ws, ok := w.stats[op]; ok {
+				s.merge(ws)
+			}
+		}
+		if len(s.latencies) == 0 {
+			continue
+		}
+		total.merge(s)
+		s.print(os.Stdout, op, elapsed)
+	}
+	total.print(os.Stdout, "total", elapsed)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "kvs-bench: %v\n", err)
+	os.Exit(1)
+}
+
+func newWorker(cfg *config, seed int64) (*worker, error) {
+	header := http.Header{}
+	if cfg.token != "" {
+		header.Set("Authorization", "Bearer "+cfg.token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(cfg.url, header)
+	if err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(seed))
+	w := &worker{cfg: cfg, conn: conn, rand: r, stats: make(map[string]*stats)}
+	if w.keys, err = newKeyChooser(r, cfg.dist, cfg.zipfS, cfg.keys); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if w.lists, err = newKeyChooser(r, cfg.dist, cfg.zipfS, cfg.skipLists); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// run sends requests until the deadline or, if n is not negative, until it
+// sent n requests.
+func (w *worker) run(deadline time.Time, n int) error {
+	for i := 0; n < 0 || i < n; i++ {
+		if n < 0 && !time.Now().Before(deadline) {
+			return nil
+		}
+		op := w.cfg.mix.pick(w.rand)
+		req := operations[op](w)
+		req.Domain = w.cfg.domain
+
+		start := time.Now()
+		resp, err := w.do(req)
+		if err != nil {
+			return err
+		}
+		s, ok := w.stats[op]
+		if !ok {
+			s = &stats{}
+			w.stats[op] = s
+		}
+		s.latencies = append(s.latencies, time.Since(start))
+		if resp.Status != "success" {
+			s.errors++
+		}
+	}
+	return nil
+}
+
+func (w *worker) do(req kvs.Request) (*kvs.Response, error) {
+	if err := w.conn.WriteJSON(req); err != nil {
+		return nil, err
+	}
+	var resp kvs.Response
+	if err := w.conn.ReadJSON(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// setup recreates the benchmark domain and, if preload is set, fills it.
+func setup(cfg *config, preload bool) error {
+	w, err := newWorker(cfg, cfg.seed)
+	if err != nil {
+		return err
+	}
+	defer w.conn.Close()
+
+	check := func(req kvs.Request) error {
+		req.Domain = cfg.domain
+		resp, err := w.do(req)
+		if err != nil {
+			return err
+		}
+		if resp.Status != "success" {
+			return fmt.Errorf("%s: %s", req.Action, resp.Message)
+		}
+		return nil
+	}
+	if err := check(kvs.Request{Action: "create_domain"}); err != nil {
+		return err
+	}
+	if !preload {
+		return nil
+	}
+
+	const batch = 1000
+	for start := 0; start < cfg.keys; start += batch {
+		req := kvs.Request{Action: "mset"}
+		for i := start; i < min(start+batch, cfg.keys); i++ {
+			req.Keys = append(req.Keys, "key:"+strconv.Itoa(i), "counter:"+strconv.Itoa(i))
+			req.Values = append(req.Values, cfg.value, "0")
+		}
+		if err := check(req); err != nil {
+			return err
+		}
+	}
+	for l := 0; l < cfg.skipLists; l++ {
+		for i := 0; i < cfg.skipListSize; i++ {
+			req := kvs.Request{Action: "insert_skiplist", SLKey: "list:" + strconv.Itoa(l), Key: strconv.Itoa(i), Value: cfg.value}
+			if err := check(req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// stats collects the outcome of the requests of one operation.
+type stats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+func (s *stats) merge(other *stats) {
+	s.latencies = append(s.latencies, other.latencies...)
+	s.errors += other.errors
+}
+
+// percentile returns the latency below which the fraction p of requests
+// completed. latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(latencies))+0.5) - 1
+	return latencies[min(max(i, 0), len(latencies)-1)]
+}
+
+func printHeader(w io.Writer) {
+	fmt.Fprintf(w, "%-16s %10s %8s %12s %10s %10s %10s %10s %10s\n",
+		"operation", "requests", "errors", "ops/s", "p50", "p90", "p99", "p99.9", "max")
+}
+
+func (s *stats) print(w io.Writer, name string, elapsed time.Duration) {
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	n := len(s.latencies)
+	fmt.Fprintf(w, "%-16s %10d %8d %12.0f %10s %10s %10s %10s %10s\n",
+		name, n, s.errors, float64(n)/elapsed.Seconds(),
+		round(percentile(s.latencies, 0.50)),
+		round(percentile(s.latencies, 0.90)),
+		round(percentile(s.latencies, 0.99)),
+		round(percentile(s.latencies, 0.999)),
+		round(percentile(s.latencies, 1)))
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	case d >= time.Microsecond:
+		return d.Round(time.Microsecond / 10)
+	}
+	return d
+}
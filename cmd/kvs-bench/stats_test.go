@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	ten := make([]time.Duration, 10)
+	for i := range ten {
+		ten[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for _, c := range []struct {
+		name      string
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{"empty", nil, 0.5, 0},
+		{"one sample, low", []time.Duration{time.Second}, 0, time.Second},
+		{"one sample, median", []time.Duration{time.Second}, 0.5, time.Second},
+		{"one sample, max", []time.Duration{time.Second}, 1, time.Second},
+		{"p0 is the minimum", ten, 0, time.Millisecond},
+		{"below the first rank", ten, 0.04, time.Millisecond},
+		{"first rank", ten, 0.1, time.Millisecond},
+		{"median", ten, 0.5, 5 * time.Millisecond},
+		{"p90 is the ninth of ten", ten, 0.9, 9 * time.Millisecond},
+		{"p99 of ten is the maximum", ten, 0.99, 10 * time.Millisecond},
+		{"p100 is the maximum", ten, 1, 10 * time.Millisecond},
+	} {
+		assert.Equal(t, c.want, percentile(c.latencies, c.p), c.name)
+	}
+}
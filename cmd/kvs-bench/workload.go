@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pauljubcse/kvs"
+)
+
+// operations builds the request of each action the benchmark can drive.
+var operations = map[string]func(w *worker) kvs.Request{
+	"set_string": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "set_string", Key: w.stringKey(), Value: w.cfg.value}
+	},
+	"get_string": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "get_string", Key: w.stringKey()}
+	},
+	"increment": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "increment", Key: w.counterKey()}
+	},
+	"insert_skiplist": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "insert_skiplist", SLKey: w.skipListKey(), Key: w.skipListEntry(), Value: w.cfg.value}
+	},
+	"search_skiplist": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "search_skiplist", SLKey: w.skipListKey(), Key: w.skipListEntry()}
+	},
+	"rank_skiplist": func(w *worker) kvs.Request {
+		return kvs.Request{Action: "rank_skiplist", SLKey: w.skipListKey(), Key: w.skipListEntry()}
+	},
+}
+
+// mix is a weighted choice of operations.
+type mix struct {
+	ops     []string
+	weights []int // cumulative
+}
+
+// parseMix parses a list such as "set_string=20,get_string=80".
+func parseMix(s string) (*mix, error) {
+	m := &mix{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		op, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if _, known := operations[op]; !known {
+			return nil, fmt.Errorf("unknown operation %q, want one of %s", op, strings.Join(operationNames(), ", "))
+		}
+		n := 1
+		if ok {
+			var err error
+			if n, err = strconv.Atoi(weight); err != nil || n < 0 {
+				return nil, fmt.Errorf("weight of %s must be a non-negative integer", op)
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		total += n
+		m.ops = append(m.ops, op)
+		m.weights = append(m.weights, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the mix needs at least one operation")
+	}
+	return m, nil
+}
+
+func (m *mix) pick(r *rand.Rand) string {
+	n := r.Intn(m.weights[len(m.weights)-1])
+	return m.ops[sort.SearchInts(m.weights, n+1)]
+}
+
+func operationNames() []string {
+	names := make([]string, 0, len(operations))
+	for op := range operations {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyChooser draws key numbers in [0, n) from the configured distribution.
+type keyChooser func() int
+
+func newKeyChooser(r *rand.Rand, dist string, s float64, n int) (keyChooser, error) {
+	switch dist {
+	case "uniform":
+		return func() int { return r.Intn(n) }, nil
+	case "zipfian":
+		if s <= 1 {
+			return nil, fmt.Errorf("zipf exponent must be greater than 1")
+		}
+		z := rand.NewZipf(r, s, 1, uint64(n-1))
+		// Scatter the hot keys so they are not all adjacent.
+		perm := r.Perm(n)
+		return func() int { return perm[z.Uint64()] }, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %q, want uniform or zipfian", dist)
+	}
+}
+
+func (w *worker) stringKey() string {
+	return "key:" + strconv.Itoa(w.keys())
+}
+
+func (w *worker) counterKey() string {
+	return "counter:" + strconv.Itoa(w.keys())
+}
+
+func (w *worker) skipListKey() string {
+	return "list:" + strconv.Itoa(w.lists())
+}
+
+func (w *worker) skipListEntry() string {
+	return strconv.Itoa(w.rand.Intn(w.cfg.skipListSize))
+}
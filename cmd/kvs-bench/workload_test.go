@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMix(t *testing.T) {
+	for _, c := range []struct {
+		spec    string
+		ops     []string
+		weights []int
+		err     string
+	}{
+		{"get_string", []string{"get_string"}, []int{1}, ""},
+		{"set_string=20, get_string=80", []string{"set_string", "get_string"}, []int{20, 100}, ""},
+		// Operations weighted 0 are left out
+		{"set_string=0,increment=3,get_string", []string{"increment", "get_string"}, []int{3, 4}, ""},
+		{"set_string=0,get_string=0", nil, nil, "the mix needs at least one operation"},
+		{"set_string=-1", nil, nil, "weight of set_string must be a non-negative integer"},
+		{"set_string=", nil, nil, "weight of set_string must be a non-negative integer"},
+		{"set_string=1.5", nil, nil, "weight of set_string must be a non-negative integer"},
+		{"del=10", nil, nil, `unknown operation "del", want one of get_string, increment, insert_skiplist, rank_skiplist, search_skiplist, set_string`},
+		{"=10", nil, nil, `unknown operation ""`},
+		{"", nil, nil, `unknown operation ""`},
+	} {
+		m, err := parseMix(c.spec)
+		if c.err != "" {
+			assert.ErrorContains(t, err, c.err, c.spec)
+			continue
+		}
+		assert.NoError(t, err, c.spec)
+		assert.Equal(t, c.ops, m.ops, c.spec)
+		assert.Equal(t, c.weights, m.weights, c.spec)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pauljubcse/kvs"
+)
+
+// actions maps every action to the request fields its positional arguments
+// fill, by JSON name. A trailing "..." takes all remaining arguments, and
+// "pairs..." alternates between keys and values.
+var actions = map[string][]string{
+	"auth":                       {"token"},
+	"acl_list":                   {},
+	"acl_set_role":               {"role"},
+	"acl_delete_role":            {"roles..."},
+	"acl_set_user":               {"user", "roles..."},
+	"acl_delete_user":            {"user"},
+	"create_domain":              {"domain"},
+	"clone_domain":               {"new_domain"},
+	"export_domain":              {},
+	"import_domain":              {"value", "mode"},
+	"set_limits":                 {"limits"},
+	"get_limits":                 {},
+	"config_memory":              {"max_memory", "policy"},
+	"memory_stats":               {},
+	"set_string":                 {"key", "value"},
+	"get_string":                 {"key"},
+	"append":                     {"key", "value"},
+	"getrange":                   {"key", "start", "stop"},
+	"setrange":                   {"key", "offset", "value"},
+	"strlen":                     {"key"},
+	"getset":                     {"key", "value"},
+	"getdel":                     {"key"},
+	"del":                        {"keys..."},
+	"exists":                     {"keys..."},
+	"type":                       {"key"},
+	"rename":                     {"key", "new_key"},
+	"renamenx":                   {"key", "new_key"},
+	"copy":                       {"key", "new_key"},
+	"scan":                       {"cursor"},
+	"scan_prefix":                {"prefix", "cursor"},
+	"scan_range":                 {"min_key", "max_key", "cursor"},
+	"mget":                       {"keys..."},
+	"mset":                       {"pairs..."},
+	"msetnx":                     {"pairs..."},
+	"insert_skiplist":            {"slkey", "key", "value"},
+	"delete_skiplist":            {"slkey", "key"},
+	"delete_range_skiplist":      {"slkey", "min_key", "max_key"},
+	"delete_rank_range_skiplist": {"slkey", "start", "stop"},
+	"rank_skiplist":              {"slkey", "key"},
+	"search_skiplist":            {"slkey", "key"},
+	"debug_skiplist":             {"slkey"},
+	"increment":                  {"key"},
+	"decrement":                  {"key"},
+	"incrby":                     {"key", "delta"},
+	"decrby":                     {"key", "delta"},
+	"incrbyfloat":                {"key", "delta"},
+}
+
+// builtins are the commands the client handles itself.
+var builtins = []string{"use", "help", "quit", "exit"}
+
+// requestFields maps the JSON names of the kvs.Request fields to their types.
+var requestFields = func() map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	t := reflect.TypeOf(kvs.Request{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = t.Field(i).Type
+	}
+	return fields
+}()
+
+// commandNames returns the actions and builtins in order.
+func commandNames() []string {
+	names := append([]string(nil), builtins...)
+	for action := range actions {
+		names = append(names, action)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usage describes the arguments of an action.
+func usage(action string) string {
+	args := []string{action}
+	for _, field := range actions[action] {
+		if field == "pairs..." {
+			args = append(args, "key value [key value ...]")
+		} else {
+			args = append(args, "<"+field+">")
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// buildRequest turns the words of a command into a request on domain.
+// Positional arguments fill the fields listed in actions; any field can also
+// be set with --name=value, or --name for booleans.
+func buildRequest(domain string, words []string) (json.RawMessage, error) {
+	action := words[0]
+	positional, ok := actions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown action %q, try help", action)
+	}
+
+	fields := map[string]any{"action": action}
+	if domain != "" {
+		fields["domain"] = domain
+	}
+	var args []string
+	for _, word := range words[1:] {
+		if name, ok := strings.CutPrefix(word, "--"); ok {
+			name, value, hasValue := strings.Cut(name, "=")
+			if err := setField(fields, name, value, hasValue); err != nil {
+				return nil, err
+			}
+		} else {
+			args = append(args, word)
+		}
+	}
+
+	for _, field := range positional {
+		if len(args) == 0 {
+			break
+		}
+		switch field {
+		case "keys...", "roles...":
+			fields[strings.TrimSuffix(field, "...")] = args
+			args = nil
+		case "pairs...":
+			if len(args)%2 != 0 {
+				return nil, fmt.Errorf("usage: %s", usage(action))
+			}
+			var keys, values []string
+			for i := 0; i < len(args); i += 2 {
+				keys = append(keys, args[i])
+				values = append(values, args[i+1])
+			}
+			fields["keys"], fields["values"] = keys, values
+			args = nil
+		default:
+			if err := setField(fields, field, args[0], true); err != nil {
+				return nil, err
+			}
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("too many arguments, usage: %s", usage(action))
+	}
+
+	// Round-trip through kvs.Request so only fields the server knows are sent.
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var req kvs.Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return json.Marshal(req)
+}
+
+// setField sets the request field with the given JSON name from its text.
+func setField(fields map[string]any, name, value string, hasValue bool) error {
+	t, ok := requestFields[name]
+	if !ok || name == "action" {
+		return fmt.Errorf("unknown field %q", name)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b := true
+		if hasValue {
+			var err error
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s must be true or false", name)
+			}
+		}
+		fields[name] = b
+	case reflect.Slice:
+		list, _ := fields[name].([]string)
+		fields[name] = append(list, value)
+	case reflect.Pointer:
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return fmt.Errorf("%s must be a JSON object: %v", name, err)
+		}
+		fields[name] = v
+	default:
+		fields[name] = value
+	}
+	return nil
+}
+
+// splitWords splits a command line into words at spaces. Single quotes
+// keep their contents literally; double quotes allow backslash escapes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			s, err := strconv.Unquote(line[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string %s", line[i:j+1])
+			}
+			word.WriteString(s)
+			i = j
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// complete expands the command name being typed at the start of line to
+// the longest prefix shared by the names it could be.
+func complete(line string, pos int) (string, int, bool) {
+	prefix := line[:pos]
+	if strings.ContainsAny(prefix, " \t") {
+		return "", 0, false
+	}
+	var matches []string
+	for _, name := range commandNames() {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	common := matches[0]
+	for _, name := range matches[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	return common + line[pos:], len(common), true
+}
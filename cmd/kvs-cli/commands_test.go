@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitWords(t *testing.T) {
+	for _, c := range []struct {
+		line  string
+		words []string
+		err   string
+	}{
+		{"", nil, ""},
+		{"  get_string \t key  ", []string{"get_string", "key"}, ""},
+		{`set_string greeting "hello world"`, []string{"set_string", "greeting", "hello world"}, ""},
+		{`set_string k "tab\there \"quoted\""`, []string{"set_string", "k", "tab\there \"quoted\""}, ""},
+		{`set_string k 'single \n "kept"'`, []string{"set_string", "k", `single \n "kept"`}, ""},
+		{`set_string k pre'fix'"post"`, []string{"set_string", "k", "prefixpost"}, ""},
+		{`set_string k ''`, []string{"set_string", "k", ""}, ""},
+		{`set_string k 'open`, nil, "unterminated quote"},
+		{`set_string k "open`, nil, "unterminated quote"},
+		{`set_string k "escaped quote\"`, nil, "unterminated quote"},
+		{`set_string k "\q"`, nil, `invalid quoted string "\q"`},
+	} {
+		words, err := splitWords(c.line)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.line)
+			continue
+		}
+		assert.NoError(t, err, c.line)
+		assert.Equal(t, c.words, words, c.line)
+	}
+}
+
+func TestBuildRequest(t *testing.T) {
+	for _, c := range []struct {
+		domain string
+		words  []string
+		json   string
+		err    string
+	}{
+		{"d", []string{"get_string", "k"}, `{"action":"get_string","domain":"d","key":"k"}`, ""},
+		{"", []string{"create_domain", "other"}, `{"action":"create_domain","domain":"other"}`, ""},
+		{"d", []string{"scan", "0", "--match=user:*", "--count=100"}, `{"action":"scan","domain":"d","cursor":"0","match":"user:*","count":"100"}`, ""},
+		// --name=value overrides the domain anywhere after the action
+		{"d", []string{"--domain=e", "get_string", "k"}, "", `unknown action "--domain=e", try help`},
+		{"d", []string{"get_string", "--domain=e", "k"}, `{"action":"get_string","domain":"e","key":"k"}`, ""},
+		// Bare --bool sets it, --bool=value parses it
+		{"d", []string{"debug_skiplist", "l", "--verbose"}, `{"action":"debug_skiplist","domain":"d","slkey":"l","verbose":true}`, ""},
+		{"d", []string{"debug_skiplist", "l", "--verbose=false"}, `{"action":"debug_skiplist","domain":"d","slkey":"l"}`, ""},
+		{"d", []string{"debug_skiplist", "l", "--verbose=maybe"}, "", "verbose must be true or false"},
+		{"d", []string{"get_string", "--nope=1"}, "", `unknown field "nope"`},
+		{"d", []string{"get_string", "--action=del"}, "", `unknown field "action"`},
+		{"d", []string{"set_limits", `{"max_keys": 10}`}, `{"action":"set_limits","domain":"d","limits":{"max_keys":10}}`, ""},
+		{"d", []string{"set_limits", "ten"}, "", "limits must be a JSON object: invalid character 'e' in literal true (expecting 'r')"},
+		// Trailing "..." takes the rest, repeated --list flags append
+		{"d", []string{"del", "a", "b", "c"}, `{"action":"del","domain":"d","keys":["a","b","c"]}`, ""},
+		{"d", []string{"get_string", "--keys=a", "--keys=b"}, `{"action":"get_string","domain":"d","keys":["a","b"]}`, ""},
+		{"d", []string{"mset", "a", "1", "b", "2"}, `{"action":"mset","domain":"d","keys":["a","b"],"values":["1","2"]}`, ""},
+		{"d", []string{"mset", "a", "1", "b"}, "", "usage: mset key value [key value ...]"},
+		{"d", []string{"get_string", "k", "extra"}, "", "too many arguments, usage: get_string <key>"},
+		{"d", []string{"memory_stats", "extra"}, "", "too many arguments, usage: memory_stats"},
+		{"d", []string{"frobnicate"}, "", `unknown action "frobnicate", try help`},
+	} {
+		data, err := buildRequest(c.domain, c.words)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, "%q", c.words)
+			continue
+		}
+		assert.NoError(t, err, "%q", c.words)
+		assert.JSONEq(t, c.json, string(data), "%q", c.words)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		pos  int
+		out  string
+		ok   bool
+	}{
+		// A single match is completed with a space after it
+		{"get_s", 5, "get_string ", true},
+		{"memory_", 7, "memory_stats ", true},
+		// Several matches complete to their longest common prefix
+		{"delete_r", 8, "delete_ran", true},
+		{"incr", 4, "incr", true},
+		{"", 0, "", true},
+		// Text after the cursor is kept
+		{"get_s k", 5, "get_string  k", true},
+		{"nothing", 7, "", false},
+		// Only the command name is completed
+		{"get_string k", 12, "", false},
+	} {
+		out, pos, ok := complete(c.line, c.pos)
+		assert.Equal(t, c.ok, ok, c.line)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, c.out, out, c.line)
+		assert.Equal(t, len(c.out)-len(c.line)+c.pos, pos, c.line)
+	}
+}
@@ -0,0 +1,301 @@
+// Command kvs-cli is an interactive client for kvs-server.
+//
+// Usage:
+//
+//	kvs-cli [-url ws://localhost:8080/ws] [-d domain] [-token token] [action args...]
+//
+// With an action on the command line it sends that one request, prints the
+// response and exits, with status 1 if the server answered with an error.
+// Otherwise it reads commands from the terminal, with history and tab
+// completion of action names, or one per line from a non-terminal stdin.
+//
+// A command is an action followed by its arguments, for example
+//
+//	set_string greeting "hello world"
+//	scan 0 --match=user:* --count=100
+//	set_limits '{"max_keys": 1000}'
+//
+// where --name=value sets any request field by its JSON name. Words are
+// split at spaces; single quotes keep their contents literally and double
+// quotes allow Go escapes. "use <domain>" sets the domain of the following
+// commands, "help" lists the actions, and a line starting with { is sent as
+// a raw JSON request.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/pauljubcse/kvs"
+	"golang.org/x/term"
+)
+
+type client struct {
+	conn   *websocket.Conn
+	domain string
+	raw    bool
+	out    io.Writer
+}
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "websocket URL of the server")
+	domain := flag.String("d", "", "domain to send requests to")
+	raw := flag.Bool("json", false, "print responses as JSON")
+	token := flag.String("token", os.Getenv("KVS_TOKEN"), "bearer token to authenticate with (default $KVS_TOKEN)")
+	flag.Parse()
+
+	header := http.Header{}
+	if *token != "" {
+		header.Set("Authorization", "Bearer "+*token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(*url, header)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvs-cli: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	c := &client{conn: conn, domain: *domain, raw: *raw, out: os.Stdout}
+
+	if flag.NArg() > 0 {
+		resp, err := c.run(flag.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kvs-cli: %v\n", err)
+			os.Exit(1)
+		}
+		if resp != nil && resp.Status != "success" {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		err = c.repl()
+	} else {
+		err = c.script(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvs-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// repl reads commands from the terminal until EOF or quit.
+func (c *client) repl() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return complete(line, pos)
+	}
+	// The terminal translates newlines for raw mode.
+	c.out = t
+
+	for {
+		t.SetPrompt(c.prompt())
+		line, err := t.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if quit := c.line(line); quit {
+			return nil
+		}
+	}
+}
+
+// script runs the commands in r, one per line.
+func (c *client) script(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if quit := c.line(scanner.Text()); quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *client) prompt() string {
+	if c.domain == "" {
+		return "kvs> "
+	}
+	return fmt.Sprintf("kvs[%s]> ", c.domain)
+}
+
+// line runs one command line and reports whether the client should quit.
+func (c *client) line(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return false
+	}
+	var err error
+	if strings.HasPrefix(line, "{") {
+		_, err = c.send(json.RawMessage(line))
+	} else {
+		var words []string
+		if words, err = splitWords(line); err == nil {
+			switch words[0] {
+			case "quit", "exit":
+				return true
+			default:
+				_, err = c.run(words)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(c.out, "(error) %v\n", err)
+	}
+	return false
+}
+
+// run handles a command given as words, returning the server's response
+// if it sent a request.
+func (c *client) run(words []string) (*kvs.Response, error) {
+	switch words[0] {
+	case "use":
+		if len(words) != 2 {
+			return nil, fmt.Errorf("usage: use <domain>")
+		}
+		c.domain = words[1]
+		return nil, nil
+	case "help":
+		c.help(words[1:])
+		return nil, nil
+	}
+	req, err := buildRequest(c.domain, words)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
+
+// send sends a request and prints the response.
+func (c *client) send(req json.RawMessage) (*kvs.Response, error) {
+	if err := c.conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		return nil, err
+	}
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var resp kvs.Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if c.raw {
+		fmt.Fprintf(c.out, "%s\n", data)
+	} else {
+		printResponse(c.out, &resp)
+	}
+	return &resp, nil
+}
+
+func (c *client) help(names []string) {
+	if len(names) == 0 {
+		names = commandNames()
+	}
+	for _, action := range names {
+		switch action {
+		case "use":
+			fmt.Fprintln(c.out, "use <domain>")
+		case "help":
+			fmt.Fprintln(c.out, "help [action ...]")
+		case "quit", "exit":
+			fmt.Fprintln(c.out, action)
+		default:
+			if _, ok := actions[action]; ok {
+				fmt.Fprintln(c.out, usage(action))
+			} else {
+				fmt.Fprintf(c.out, "(error) unknown action %q\n", action)
+			}
+		}
+	}
+}
+
+// printResponse prints resp the way redis-cli would: errors flagged, values
+// one per line and numbered when there are several.
+func printResponse(w io.Writer, resp *kvs.Response) {
+	if resp.Status != "success" {
+		fmt.Fprintf(w, "(%s) %s\n", resp.Status, resp.Message)
+		if resp.RetryAfterMs > 0 {
+			fmt.Fprintf(w, "retry after %dms\n", resp.RetryAfterMs)
+		}
+		return
+	}
+
+	printed := false
+	if resp.Cursor != "" {
+		fmt.Fprintf(w, "cursor: %s\n", resp.Cursor)
+		printed = true
+	}
+	if resp.Value != "" {
+		fmt.Fprintln(w, strings.TrimSuffix(resp.Value, "\n"))
+		printed = true
+	}
+	n := max(len(resp.Keys), len(resp.Values))
+	for i := 0; i < n; i++ {
+		var key, value string
+		if i < len(resp.Keys) {
+			key = resp.Keys[i]
+		}
+		if i < len(resp.Values) {
+			value = resp.Values[i]
+			if i < len(resp.Found) && !resp.Found[i] {
+				value = "(nil)"
+			}
+		}
+		switch {
+		case len(resp.Keys) > 0 && len(resp.Values) > 0:
+			fmt.Fprintf(w, "%d) %s => %s\n", i+1, key, value)
+		case len(resp.Keys) > 0:
+			fmt.Fprintf(w, "%d) %s\n", i+1, key)
+		default:
+			fmt.Fprintf(w, "%d) %s\n", i+1, value)
+		}
+		printed = true
+	}
+	var details []any
+	if resp.SkipList != nil {
+		details = append(details, resp.SkipList)
+	}
+	if resp.Memory != nil {
+		details = append(details, resp.Memory)
+	}
+	if resp.Limits != nil {
+		details = append(details, resp.Limits)
+	}
+	if resp.ACL != nil {
+		details = append(details, resp.ACL)
+	}
+	for _, v := range details {
+		data, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintf(w, "%s\n", data)
+		printed = true
+	}
+	if !printed {
+		if len(resp.Found) == 1 && !resp.Found[0] {
+			fmt.Fprintln(w, "(nil)")
+		} else {
+			fmt.Fprintln(w, "OK")
+		}
+	}
+}
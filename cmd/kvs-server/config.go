@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pauljubcse/kvs"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the YAML configuration file of kvs-server. See
+// kvs-server.example.yaml for a commented example.
+type config struct {
+	// Listen is the ws:// or wss:// URL to serve on; Path, if set,
+	// replaces the path of that URL.
+	Listen string `yaml:"listen"`
+	Path   string `yaml:"path"`
+
+	TLS struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+		// ClientCAFile enables client certificates, verified against the
+		// CAs in this file; RequireClientCert refuses clients without one.
+		ClientCAFile      string `yaml:"client_ca_file"`
+		RequireClientCert bool   `yaml:"require_client_cert"`
+	} `yaml:"tls"`
+
+	Connections struct {
+		// AllowedOrigins are the browser origins besides the server's own
+		// that may connect, or "*" for any.
+		AllowedOrigins []string `yaml:"allowed_origins"`
+		// MaxMessageSize is the largest request accepted, in bytes; 0 is
+		// unlimited.
+		MaxMessageSize int64 `yaml:"max_message_size"`
+		// MaxConnections and MaxConnectionsPerIP cap the open connections
+		// in total and from one address; 0 is unlimited.
+		MaxConnections      int `yaml:"max_connections"`
+		MaxConnectionsPerIP int `yaml:"max_connections_per_ip"`
+		// IdleTimeout drops clients that neither send requests nor answer
+		// pings for this long; 0 never does.
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+	} `yaml:"connections"`
+
+	// RateLimits cap the requests of every connection and of every
+	// authenticated user; domains have their own in their limits.
+	RateLimits struct {
+		Connection rateLimit `yaml:"connection"`
+		User       rateLimit `yaml:"user"`
+	} `yaml:"rate_limits"`
+
+	Persistence struct {
+		Dir      string        `yaml:"dir"`
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"persistence"`
+
+	Auth struct {
+		// Users that may connect. Authentication is required as soon as
+		// one is configured.
+		Users []userConfig `yaml:"users"`
+		// Roles turn on access control: users may then only do what
+		// their roles grant.
+		Roles []kvs.Role `yaml:"roles"`
+	} `yaml:"auth"`
+
+	// MaxMemory caps the memory of all domains together, in bytes.
+	MaxMemory int64 `yaml:"max_memory"`
+	// Limits are the quotas of the domains below that set none of their own.
+	Limits kvs.Limits `yaml:"limits"`
+	// SkipList sets the skip list parameters of the domains below that
+	// set none of their own.
+	SkipList kvs.SkipListConfig `yaml:"skiplist"`
+	Domains  []domainConfig     `yaml:"domains"`
+}
+
+// userConfig describes a user, the bearer tokens that authenticate it and
+// its roles. Users with a client certificate are authenticated by its
+// common name and need no tokens.
+type userConfig struct {
+	Name   string   `yaml:"name"`
+	Tokens []string `yaml:"tokens"`
+	Roles  []string `yaml:"roles"`
+}
+
+// rateLimit allows RequestsPerSecond on average, with bursts of up to Burst
+// requests. 0 requests per second is unlimited.
+type rateLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// domainConfig describes a domain created at startup.
+type domainConfig struct {
+	Name      string              `yaml:"name"`
+	Limits    *kvs.Limits         `yaml:"limits"`
+	MaxMemory int64               `yaml:"max_memory"`
+	Policy    string              `yaml:"policy"`
+	SkipList  *kvs.SkipListConfig `yaml:"skiplist"`
+}
+
+func defaultConfig() *config {
+	cfg := &config{Listen: "ws://localhost:8080/ws"}
+	cfg.Connections.MaxMessageSize = kvs.DefaultMaxMessageSize
+	return cfg
+}
+
+// loadConfig reads the file at path over the defaults.
+func loadConfig(path string) (*config, error) {
+	cfg := defaultConfig()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// listenURL returns Listen with Path applied.
+func (c *config) listenURL() (string, error) {
+	u, err := url.Parse(c.Listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen URL: %v", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return "", fmt.Errorf("listen URL must start with ws:// or wss://")
+	}
+	if c.Path != "" {
+		u.Path = c.Path
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+// newStore creates a store with the configured memory limit and domains.
+func (c *config) newStore() (*kvs.Store, error) {
+	store := kvs.NewStore()
+	store.SetMaxMemory(c.MaxMemory)
+	for _, dc := range c.Domains {
+		if dc.Name == "" {
+			return nil, fmt.Errorf("domains need a name")
+		}
+		limits := c.Limits
+		if dc.Limits != nil {
+			limits = *dc.Limits
+		}
+		if err := store.CreateDomainWithLimits(dc.Name, limits); err != nil {
+			return nil, fmt.Errorf("domain %q: %v", dc.Name, err)
+		}
+		if err := store.ConfigureMemory(dc.Name, fmt.Sprint(dc.MaxMemory), dc.Policy); err != nil {
+			return nil, fmt.Errorf("domain %q: %v", dc.Name, err)
+		}
+		skipList := c.SkipList
+		if dc.SkipList != nil {
+			skipList = *dc.SkipList
+		}
+		if err := store.ConfigureSkipLists(dc.Name, skipList); err != nil {
+			return nil, fmt.Errorf("domain %q: %v", dc.Name, err)
+		}
+	}
+	return store, nil
+}
+
+// tokens returns the bearer tokens of all users, mapped to the user names.
+func (c *config) tokens() (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, user := range c.Auth.Users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("users need a name")
+		}
+		for _, token := range user.Tokens {
+			if other, ok := tokens[token]; ok {
+				return nil, fmt.Errorf("users %q and %q share a token", other, user.Name)
+			}
+			tokens[token] = user.Name
+		}
+	}
+	return tokens, nil
+}
+
+// acl returns the access control list of the configured roles, or nil if
+// none are configured.
+func (c *config) acl() (*kvs.ACL, error) {
+	if len(c.Auth.Roles) == 0 {
+		return nil, nil
+	}
+	acl := kvs.NewACL()
+	for _, role := range c.Auth.Roles {
+		if err := acl.SetRole(role); err != nil {
+			return nil, fmt.Errorf("role %q: %v", role.Name, err)
+		}
+	}
+	for _, user := range c.Auth.Users {
+		if err := acl.SetUser(user.Name, user.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return acl, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pauljubcse/kvs"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfig writes a configuration file to a temporary directory and
+// returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	path := filepath.Join(t.TempDir(), "kvs-server.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		yaml  string
+		err   string
+		check func(t *testing.T, cfg *config)
+	}{
+		{
+			name: "empty file keeps the defaults",
+			yaml: "",
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, defaultConfig(), cfg)
+			},
+		},
+		{
+			name: "settings",
+			yaml: `listen: wss://0.0.0.0:9000/kvs
+connections:
+  allowed_origins: [https://app.example.com]
+  max_connections: 10
+  idle_timeout: 30s
+rate_limits:
+  user:
+    requests_per_second: 5
+    burst: 10
+max_memory: 1000000
+limits:
+  max_keys: 100
+domains:
+  - name: sessions
+    max_memory: 5000
+    policy: allkeys-lru
+`,
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, "wss://0.0.0.0:9000/kvs", cfg.Listen)
+				assert.Equal(t, []string{"https://app.example.com"}, cfg.Connections.AllowedOrigins)
+				assert.Equal(t, 10, cfg.Connections.MaxConnections)
+				assert.Equal(t, 30*time.Second, cfg.Connections.IdleTimeout)
+				assert.Equal(t, int64(kvs.DefaultMaxMessageSize), cfg.Connections.MaxMessageSize)
+				assert.Equal(t, rateLimit{RequestsPerSecond: 5, Burst: 10}, cfg.RateLimits.User)
+				assert.Equal(t, int64(1000000), cfg.MaxMemory)
+				assert.Equal(t, 100, cfg.Limits.MaxKeys)
+				assert.Equal(t, []domainConfig{{Name: "sessions", MaxMemory: 5000, Policy: "allkeys-lru"}}, cfg.Domains)
+			},
+		},
+		{
+			name: "unknown fields are refused",
+			yaml: "listen: ws://localhost:8080/ws\nlisten_addr: :8080\n",
+			err:  "field listen_addr not found",
+		},
+		{
+			name: "unknown nested fields are refused",
+			yaml: "connections:\n  max_conns: 10\n",
+			err:  "field max_conns not found",
+		},
+		{
+			name: "bad values are refused",
+			yaml: "connections:\n  idle_timeout: soon\n",
+			err:  "cannot unmarshal",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := loadConfig(writeConfig(t, c.yaml))
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			c.check(t, cfg)
+		})
+	}
+
+	_, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseFlags(t *testing.T) {
+	path := writeConfig(t, `listen: ws://localhost:9000/kvs
+max_memory: 1000
+connections:
+  max_connections: 10
+  max_connections_per_ip: 2
+`)
+	for _, c := range []struct {
+		name  string
+		args  []string
+		err   string
+		check func(t *testing.T, cfg *config)
+	}{
+		{
+			name: "defaults without a file",
+			args: nil,
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, defaultConfig(), cfg)
+			},
+		},
+		{
+			name: "the file alone",
+			args: []string{"-config", path},
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, "ws://localhost:9000/kvs", cfg.Listen)
+				assert.Equal(t, int64(1000), cfg.MaxMemory)
+				assert.Equal(t, 10, cfg.Connections.MaxConnections)
+			},
+		},
+		{
+			name: "flags override the file",
+			args: []string{"-config", path, "-listen", "ws://127.0.0.1:1/x", "-max-memory", "0", "-max-connections", "3",
+				"-allowed-origins", "https://a.example.com,https://b.example.com", "-idle-timeout", "1m", "-user-rate", "2.5"},
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, "ws://127.0.0.1:1/x", cfg.Listen)
+				assert.Equal(t, int64(0), cfg.MaxMemory)
+				assert.Equal(t, 3, cfg.Connections.MaxConnections)
+				assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.Connections.AllowedOrigins)
+				assert.Equal(t, time.Minute, cfg.Connections.IdleTimeout)
+				assert.Equal(t, 2.5, cfg.RateLimits.User.RequestsPerSecond)
+			},
+		},
+		{
+			name: "flags that are not set leave the file alone",
+			args: []string{"-config", path, "-max-connections", "3"},
+			check: func(t *testing.T, cfg *config) {
+				assert.Equal(t, 3, cfg.Connections.MaxConnections)
+				assert.Equal(t, 2, cfg.Connections.MaxConnectionsPerIP)
+				assert.Equal(t, "ws://localhost:9000/kvs", cfg.Listen)
+			},
+		},
+		{
+			name: "unknown flags are refused",
+			args: []string{"-listen-addr", ":8080"},
+			err:  "flag provided but not defined: -listen-addr",
+		},
+		{
+			name: "a missing file is refused",
+			args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			err:  "no such file or directory",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("kvs-server", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			cfg, err := parseFlags(fs, c.args)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			c.check(t, cfg)
+		})
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		yaml  string
+		err   string
+		check func(t *testing.T, store *kvs.Store)
+	}{
+		{
+			name: "domains get the shared limits unless they set their own",
+			yaml: `limits:
+  max_keys: 100
+domains:
+  - name: shared
+  - name: own
+    limits:
+      max_skiplists: 4
+`,
+			check: func(t *testing.T, store *kvs.Store) {
+				limits, err := store.Limits("shared")
+				assert.NoError(t, err)
+				assert.Equal(t, kvs.Limits{MaxKeys: 100}, *limits)
+				limits, err = store.Limits("own")
+				assert.NoError(t, err)
+				assert.Equal(t, kvs.Limits{MaxSkipLists: 4}, *limits)
+			},
+		},
+		{
+			name: "memory limits and policies",
+			yaml: `max_memory: 1000000
+domains:
+  - name: cache
+    max_memory: 5000
+    policy: allkeys-lfu
+  - name: plain
+`,
+			check: func(t *testing.T, store *kvs.Store) {
+				stats, err := store.MemoryStats("cache")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(5000), stats.Limit)
+				assert.Equal(t, string(kvs.AllKeysLFU), stats.Policy)
+				assert.Equal(t, int64(1000000), stats.StoreLimit)
+				stats, err = store.MemoryStats("plain")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(0), stats.Limit)
+				assert.Equal(t, string(kvs.NoEviction), stats.Policy)
+			},
+		},
+		{
+			name: "domains need a name",
+			yaml: "domains:\n  - max_memory: 10\n",
+			err:  "domains need a name",
+		},
+		{
+			name: "unknown policies are refused",
+			yaml: "domains:\n  - name: cache\n    policy: volatile-lru\n",
+			err:  `domain "cache": unknown eviction policy "volatile-lru"`,
+		},
+		{
+			name: "negative limits are refused",
+			yaml: "limits:\n  max_keys: -1\ndomains:\n  - name: d\n",
+			err:  `domain "d": limits must not be negative`,
+		},
+		{
+			name: "bad skip list parameters are refused",
+			yaml: "domains:\n  - name: d\n    skiplist:\n      p: 1.5\n",
+			err:  `domain "d"`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := loadConfig(writeConfig(t, c.yaml))
+			assert.NoError(t, err)
+			store, err := cfg.newStore()
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			c.check(t, store)
+		})
+	}
+}
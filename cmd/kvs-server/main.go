@@ -0,0 +1,182 @@
+// Command kvs-server runs a key-value store server.
+//
+// Usage:
+//
+//	kvs-server [-config kvs-server.yaml] [flags]
+//
+// Flags override the matching settings of the configuration file. The
+// server saves its snapshot and exits cleanly on SIGINT or SIGTERM, and
+// reloads its TLS certificates on SIGHUP.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pauljubcse/kvs"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseFlags parses args into fs, loads the configuration file they name,
+// if any, and applies the flags that were set on top of it.
+func parseFlags(fs *flag.FlagSet, args []string) (*config, error) {
+	configPath := fs.String("config", "", "path of the YAML configuration file")
+	listen := fs.String("listen", "", "ws:// or wss:// URL to serve on (default ws://localhost:8080/ws)")
+	path := fs.String("path", "", "websocket path, replacing the path of the listen URL")
+	dataDir := fs.String("data-dir", "", "directory to persist snapshots in")
+	interval := fs.Duration("snapshot-interval", 0, "how often to save snapshots; 0 saves only on shutdown")
+	certFile := fs.String("tls-cert", "", "PEM certificate file for wss://")
+	keyFile := fs.String("tls-key", "", "PEM key file for wss://")
+	clientCA := fs.String("tls-client-ca", "", "PEM file of the CAs to verify client certificates against")
+	requireClientCert := fs.Bool("tls-require-client-cert", false, "refuse clients without a valid certificate")
+	allowedOrigins := fs.String("allowed-origins", "", "comma-separated browser origins allowed to connect, or * for any")
+	maxMessageSize := fs.Int64("max-message-size", kvs.DefaultMaxMessageSize, "largest request accepted, in bytes; 0 is unlimited")
+	maxConns := fs.Int("max-connections", 0, "maximum open connections; 0 is unlimited")
+	maxConnsPerIP := fs.Int("max-connections-per-ip", 0, "maximum open connections from one address; 0 is unlimited")
+	idleTimeout := fs.Duration("idle-timeout", 0, "drop clients idle for this long; 0 never does")
+	connRate := fs.Float64("connection-rate", 0, "requests per second allowed on each connection; 0 is unlimited")
+	connBurst := fs.Int("connection-burst", 0, "requests a connection may send in a burst")
+	userRate := fs.Float64("user-rate", 0, "requests per second allowed for each user; 0 is unlimited")
+	userBurst := fs.Int("user-burst", 0, "requests a user may send in a burst")
+	maxMemory := fs.Int64("max-memory", 0, "memory limit of all domains together, in bytes")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			return nil, err
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Listen = *listen
+		case "path":
+			cfg.Path = *path
+		case "data-dir":
+			cfg.Persistence.Dir = *dataDir
+		case "snapshot-interval":
+			cfg.Persistence.Interval = *interval
+		case "tls-cert":
+			cfg.TLS.CertFile = *certFile
+		case "tls-key":
+			cfg.TLS.KeyFile = *keyFile
+		case "tls-client-ca":
+			cfg.TLS.ClientCAFile = *clientCA
+		case "tls-require-client-cert":
+			cfg.TLS.RequireClientCert = *requireClientCert
+		case "allowed-origins":
+			cfg.Connections.AllowedOrigins = strings.Split(*allowedOrigins, ",")
+		case "max-message-size":
+			cfg.Connections.MaxMessageSize = *maxMessageSize
+		case "max-connections":
+			cfg.Connections.MaxConnections = *maxConns
+		case "max-connections-per-ip":
+			cfg.Connections.MaxConnectionsPerIP = *maxConnsPerIP
+		case "idle-timeout":
+			cfg.Connections.IdleTimeout = *idleTimeout
+		case "connection-rate":
+			cfg.RateLimits.Connection.RequestsPerSecond = *connRate
+		case "connection-burst":
+			cfg.RateLimits.Connection.Burst = *connBurst
+		case "user-rate":
+			cfg.RateLimits.User.RequestsPerSecond = *userRate
+		case "user-burst":
+			cfg.RateLimits.User.Burst = *userBurst
+		case "max-memory":
+			cfg.MaxMemory = *maxMemory
+		}
+	})
+	return cfg, nil
+}
+
+func run(cfg *config) error {
+	listenURL, err := cfg.listenURL()
+	if err != nil {
+		return err
+	}
+	store, err := cfg.newStore()
+	if err != nil {
+		return err
+	}
+
+	opts := []kvs.ServerOption{
+		kvs.WithStore(store),
+		kvs.WithAllowedOrigins(cfg.Connections.AllowedOrigins...),
+		kvs.WithMaxMessageSize(cfg.Connections.MaxMessageSize),
+		kvs.WithMaxConnections(cfg.Connections.MaxConnections, cfg.Connections.MaxConnectionsPerIP),
+		kvs.WithIdleTimeout(cfg.Connections.IdleTimeout),
+		kvs.WithConnectionRateLimit(cfg.RateLimits.Connection.RequestsPerSecond, cfg.RateLimits.Connection.Burst),
+		kvs.WithUserRateLimit(cfg.RateLimits.User.RequestsPerSecond, cfg.RateLimits.User.Burst),
+	}
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		opts = append(opts, kvs.WithTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		opts = append(opts, kvs.WithClientCA(cfg.TLS.ClientCAFile, cfg.TLS.RequireClientCert))
+	}
+	if len(cfg.Auth.Users) > 0 {
+		tokens, err := cfg.tokens()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, kvs.WithAuthTokens(tokens))
+	}
+	acl, err := cfg.acl()
+	if err != nil {
+		return err
+	}
+	if acl != nil {
+		opts = append(opts, kvs.WithACL(acl))
+	}
+	if cfg.Persistence.Dir != "" {
+		opts = append(opts, kvs.WithPersistence(cfg.Persistence.Dir, cfg.Persistence.Interval))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server, err := kvs.StartServer(listenURL, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Listening on %s\n", server.Addr())
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for done := false; !done; {
+		select {
+		case <-hup:
+			if err := server.ReloadTLS(); err != nil {
+				log.Printf("reloading TLS certificates: %v", err)
+			} else {
+				log.Printf("reloaded TLS certificates")
+			}
+		case <-ctx.Done():
+			done = true
+		}
+	}
+	stop()
+
+	fmt.Println("Shutting down...")
+	return server.CloseServer()
+}
@@ -0,0 +1,163 @@
+package kvs
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultMaxMessageSize is the largest request a Server reads unless
+// WithMaxMessageSize says otherwise.
+const DefaultMaxMessageSize = 16 << 20
+
+var (
+	errTooManyConnections   = errors.New("too many connections")
+	errTooManyIPConnections = errors.New("too many connections from this address")
+)
+
+// WithAllowedOrigins lets browsers on the given origins, such as
+// "https://app.example.com", use the websocket, export and import
+// endpoints, or those on any origin with "*". Pages served from the
+// server's own host are always allowed, and clients that send no Origin
+// header, which browsers always do, are not checked.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.allowedOrigins = origins
+	}
+}
+
+// WithMaxMessageSize closes connections that send a message larger than n
+// bytes and refuses import bodies larger than n bytes, instead of
+// DefaultMaxMessageSize. 0 means no limit.
+func WithMaxMessageSize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxMessageSize = n
+	}
+}
+
+// WithMaxConnections refuses websocket connections beyond total open at
+// once, or beyond perIP from one client address. 0 means no limit.
+func WithMaxConnections(total, perIP int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = total
+		s.maxConnsPerIP = perIP
+	}
+}
+
+// WithIdleTimeout closes connections that send nothing for d. The server
+// pings every client twice per d, so clients that keep reading and answer
+// pings stay connected while they have no requests; dead ones are closed.
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// checkOrigin is the websocket.Upgrader.CheckOrigin of a Server.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin wraps the HTTP handler next to refuse browsers on origins
+// that checkOrigin would not let open a websocket either, so other sites
+// cannot drive the endpoint from a visitor's browser.
+func (s *Server) allowOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientIP returns the address r comes from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admit reserves a connection from ip within the connection limits. Every
+// successful admit must be followed by a release.
+func (s *Server) admit(ip string) error {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.maxConns > 0 && s.connCount >= s.maxConns {
+		return errTooManyConnections
+	}
+	if s.maxConnsPerIP > 0 && s.connsPerIP[ip] >= s.maxConnsPerIP {
+		return errTooManyIPConnections
+	}
+	s.connCount++
+	s.connsPerIP[ip]++
+	return nil
+}
+
+func (s *Server) release(ip string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.connCount--
+	if s.connsPerIP[ip]--; s.connsPerIP[ip] == 0 {
+		delete(s.connsPerIP, ip)
+	}
+}
+
+// extendDeadline gives conn another timeout to receive its next message.
+// The deadline is set before closing is checked, so it never replaces the
+// one drain sets to interrupt the read.
+func extendDeadline(conn *websocket.Conn, closing *atomic.Bool, timeout time.Duration) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if closing != nil && closing.Load() {
+		conn.SetReadDeadline(time.Now())
+	}
+}
+
+// keepAlive pings conn every half timeout and extends its read deadline
+// whenever a pong comes back, until the returned function is called.
+func keepAlive(conn *websocket.Conn, closing *atomic.Bool, timeout time.Duration) (stop func()) {
+	conn.SetPongHandler(func(string) error {
+		extendDeadline(conn, closing, timeout)
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout/2)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
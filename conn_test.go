@@ -0,0 +1,110 @@
+package kvs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	server, err := StartServer("ws://127.0.0.1:0/kvs",
+		WithAllowedOrigins("https://app.example.com"),
+		WithMaxMessageSize(1024),
+		WithMaxConnections(3, 2),
+		WithIdleTimeout(200*time.Millisecond))
+	assert.NoError(t, err)
+	defer server.CloseServer()
+	url := "ws://" + server.Addr().String() + "/kvs"
+	dial := func(origin string) (*websocket.Conn, *http.Response, error) {
+		var header http.Header
+		if origin != "" {
+			header = http.Header{"Origin": {origin}}
+		}
+		return websocket.DefaultDialer.Dial(url, header)
+	}
+
+	// Browsers only connect from the server's host and the allowed origins
+	_, res, err := dial("https://evil.example.com")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	for _, origin := range []string{"", "https://app.example.com", "http://" + server.Addr().String()} {
+		conn, _, err := dial(origin)
+		assert.NoError(t, err, origin)
+		conn.Close()
+	}
+
+	// and so do the export and import endpoints
+	base := "http://" + server.Addr().String() + "/kvs"
+	req, _ := http.NewRequest("POST", base+"/import?domain=d&mode=overwrite", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Origin", "https://evil.example.com")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	req, _ = http.NewRequest("GET", base+"/export?domain=d", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	req, _ = http.NewRequest("POST", base+"/import?domain=d", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Origin", "https://app.example.com")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Oversized requests close the connection
+	conn, _, err := dial("")
+	assert.NoError(t, err)
+	assert.NoError(t, conn.WriteJSON(Request{Action: "set_string", Domain: "d", Key: "k", Value: strings.Repeat("x", 2048)}))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "got %v", err)
+	conn.Close()
+
+	// Two connections per address are allowed
+	waitConns := func(n int) {
+		assert.Eventually(t, func() bool {
+			server.connsMu.Lock()
+			defer server.connsMu.Unlock()
+			return server.connCount == n
+		}, time.Second, 10*time.Millisecond)
+	}
+	waitConns(0)
+	first, _, err := dial("")
+	assert.NoError(t, err)
+	defer first.Close()
+	second, _, err := dial("")
+	assert.NoError(t, err)
+	_, res, err = dial("")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	second.Close()
+	waitConns(1)
+
+	// A client that keeps reading answers pings and stays connected, one
+	// that does not read is dropped
+	responsive, _, err := dial("")
+	assert.NoError(t, err)
+	defer responsive.Close()
+	pings := make(chan error, 1)
+	go func() {
+		_, _, err := responsive.ReadMessage()
+		pings <- err
+	}()
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case err := <-pings:
+		t.Fatalf("responsive client was dropped: %v", err)
+	default:
+	}
+	_, _, err = first.ReadMessage()
+	assert.Error(t, err)
+	waitConns(1)
+}
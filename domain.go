@@ -1,16 +1,233 @@
 package kvs
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
+// Domain holds the string and skip list stores of one use case. mu guards
+// the two maps; each SkipList carries its own lock so operations on one
+// list do not serialize the rest of the domain.
+//
+// stringKeys and skipListKeys index the keys of stringStore and
+// skipListStore in order; writes go through setString, deleteString,
+// putSkipList and dropSkipList to keep them in step and to keep the memory
+// accounting current.
 type Domain struct {
 	stringStore   map[string]string
+	stringKeys    *keyIndex
 	skipListStore map[string]*SkipList
+	skipListKeys  *keyIndex
 	mu            sync.RWMutex
+
+	memory      memoryBudget
+	storeMemory atomic.Pointer[memoryBudget]
+	policy      EvictionPolicy
+	access      map[string]*keyAccess
+	clock       atomic.Int64
+	evicted     atomic.Int64
+
+	limits  atomic.Pointer[Limits]
+	limiter atomic.Pointer[tokenBucket]
+
+	// skipLists configures the lists created from now on.
+	skipLists atomic.Pointer[SkipListConfig]
 }
 
 func NewDomain() *Domain {
-	return &Domain{
+	d := &Domain{
 		stringStore:   make(map[string]string),
+		stringKeys:    newKeyIndex(),
 		skipListStore: make(map[string]*SkipList),
+		skipListKeys:  newKeyIndex(),
+		policy:        NoEviction,
+		access:        make(map[string]*keyAccess),
+	}
+	d.limits.Store(&Limits{})
+	d.skipLists.Store(&SkipListConfig{})
+	return d
+}
+
+// newSkipList returns an empty list configured for the domain.
+func (d *Domain) newSkipList() *SkipList {
+	return NewSkipList(d.skipLists.Load().options()...)
+}
+
+// setString stores value under key, enforcing the domain's limits and
+// evicting other keys first if the domain is out of memory. d.mu must be
+// held.
+func (d *Domain) setString(key, value string) error {
+	if err := d.checkString(key, value); err != nil {
+		return err
+	}
+	need := stringSize(key, value)
+	if old, ok := d.stringStore[key]; ok {
+		need -= stringSize(key, old)
+	}
+	if err := d.makeRoom(need); err != nil {
+		return err
+	}
+	d.putString(key, value)
+	return nil
+}
+
+// putString is setString for callers that already made room. d.mu must be
+// held.
+func (d *Domain) putString(key, value string) {
+	if old, ok := d.stringStore[key]; ok {
+		d.charge(-stringSize(key, old))
+	} else {
+		d.stringKeys.insert(key)
+	}
+	d.stringStore[key] = value
+	d.charge(stringSize(key, value))
+	d.track(key)
+}
+
+// deleteString removes key from the string store. d.mu must be held.
+func (d *Domain) deleteString(key string) {
+	if value, ok := d.stringStore[key]; ok {
+		d.stringKeys.delete(key)
+		delete(d.stringStore, key)
+		d.charge(-stringSize(key, value))
+		d.untrack(key)
+	}
+}
+
+// skipList looks up a list, holding the domain lock only for the lookup.
+func (d *Domain) skipList(slkey string) (*SkipList, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	sl, ok := d.skipListStore[slkey]
+	if ok {
+		d.touch(slkey)
+	}
+	return sl, ok
+}
+
+// lockSkipList returns the list stored under slkey with its write lock
+// held, creating the list first if create is set; otherwise a missing list
+// gives nil. Lists dropped from the domain while we waited for the lock are
+// skipped so writes never land in an orphaned list.
+func (d *Domain) lockSkipList(slkey string, create bool) (*SkipList, error) {
+	for {
+		sl, ok := d.skipList(slkey)
+		if !ok {
+			if !create {
+				return nil, nil
+			}
+			var err error
+			if sl, err = d.createSkipList(slkey); err != nil {
+				return nil, err
+			}
+		}
+
+		sl.mu.Lock()
+		if !sl.dropped {
+			return sl, nil
+		}
+		sl.mu.Unlock()
+	}
+}
+
+// createSkipList returns the list stored under slkey, creating it if the
+// domain's limits allow.
+func (d *Domain) createSkipList(slkey string) (*SkipList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sl, ok := d.skipListStore[slkey]; ok {
+		return sl, nil
+	}
+	if err := d.checkNewSkipList(slkey); err != nil {
+		return nil, err
 	}
-}
\ No newline at end of file
+	sl := d.newSkipList()
+	d.putSkipList(slkey, sl)
+	return sl, nil
+}
+
+// putSkipList stores sl, which no other goroutine may hold yet, under
+// slkey. d.mu must be held.
+func (d *Domain) putSkipList(slkey string, sl *SkipList) {
+	if _, ok := d.skipListStore[slkey]; !ok {
+		d.skipListKeys.insert(slkey)
+	}
+	d.skipListStore[slkey] = sl
+	d.charge(skipListSize(slkey, sl))
+	d.track(slkey)
+}
+
+// dropSkipList removes the list stored under slkey. d.mu must be held.
+func (d *Domain) dropSkipList(slkey string) {
+	sl, ok := d.skipListStore[slkey]
+	if !ok {
+		return
+	}
+	sl.mu.Lock()
+	sl.dropped = true
+	d.charge(-skipListSize(slkey, sl))
+	sl.mu.Unlock()
+	delete(d.skipListStore, slkey)
+	d.skipListKeys.delete(slkey)
+	d.untrack(slkey)
+}
+
+// dropIfEmpty removes sl from the domain once its last element is gone, so
+// empty lists do not linger. Skip list actions therefore treat a missing
+// list as an empty one. sl.mu must not be held.
+func (d *Domain) dropIfEmpty(slkey string, sl *SkipList) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.skipListStore[slkey] != sl {
+		return
+	}
+	sl.mu.RLock()
+	empty := sl.Len() == 0
+	sl.mu.RUnlock()
+	if empty {
+		d.dropSkipList(slkey)
+	}
+}
+
+// keyType reports what key holds. A name can hold both a string and a skip
+// list; the string is reported first.
+func (d *Domain) keyType(key string) string {
+	if _, ok := d.stringStore[key]; ok {
+		return "string"
+	}
+	if _, ok := d.skipListStore[key]; ok {
+		return "skiplist"
+	}
+	return "none"
+}
+
+// deleteKey removes key from both stores and reports whether it existed.
+// d.mu must be held.
+func (d *Domain) deleteKey(key string) bool {
+	if d.keyType(key) == "none" {
+		return false
+	}
+	d.deleteString(key)
+	d.dropSkipList(key)
+	return true
+}
+
+// clone returns a deep copy of the domain's data and settings that does
+// not belong to any store yet. d.mu must be held.
+func (d *Domain) clone() *Domain {
+	c := NewDomain()
+	c.policy = d.policy
+	c.memory.limit.Store(d.memory.limit.Load())
+	c.setLimits(*d.limits.Load())
+	c.skipLists.Store(d.skipLists.Load())
+
+	for x := d.stringKeys.head.next[0]; x != nil; x = x.next[0] {
+		c.putString(x.key, d.stringStore[x.key])
+	}
+	for slkey, sl := range d.skipListStore {
+		sl.mu.RLock()
+		c.putSkipList(slkey, sl.Clone())
+		sl.mu.RUnlock()
+	}
+	return c
+}
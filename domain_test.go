@@ -0,0 +1,44 @@
+package kvs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneDomain(t *testing.T) {
+	store := NewStore()
+	assert.NoError(t, store.CreateDomainWithLimits("prod", Limits{MaxKeys: 10}))
+	assert.NoError(t, store.ConfigureMemory("prod", "1000000", string(AllKeysLRU)))
+	assert.NoError(t, store.SetString("prod", "a", "1"))
+	assert.NoError(t, store.InsertToSkipList("prod", "l", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("prod", "l", "2", "two"))
+
+	assert.NoError(t, store.CloneDomain("prod", "staging"))
+	assert.EqualError(t, store.CloneDomain("prod", "staging"), "domain already exists")
+	assert.EqualError(t, store.CloneDomain("missing", "other"), "domain not found")
+
+	// Writes to the clone leave the source untouched and vice versa
+	assert.NoError(t, store.SetString("staging", "a", "2"))
+	assert.NoError(t, store.InsertToSkipList("staging", "l", "3", "three"))
+	assert.NoError(t, store.DeleteFromSkipList("prod", "l", "1"))
+
+	value, _ := store.GetString("prod", "a")
+	assert.Equal(t, "1", value)
+	value, _ = store.GetString("staging", "a")
+	assert.Equal(t, "2", value)
+	_, err := store.SearchInSkipList("prod", "l", "3")
+	assert.Error(t, err)
+	value, _ = store.SearchInSkipList("staging", "l", "1")
+	assert.Equal(t, "one", value)
+
+	limits, err := store.Limits("staging")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limits.MaxKeys)
+	stats, err := store.MemoryStats("staging")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000), stats.Limit)
+	assert.Equal(t, string(AllKeysLRU), stats.Policy)
+	prod, _ := store.MemoryStats("prod")
+	assert.Equal(t, prod.Used+stats.Used, stats.StoreUsed)
+}
@@ -0,0 +1,346 @@
+package kvs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Record is one line of a domain export: a string key or a whole skip list.
+type Record struct {
+	Type    string          `json:"type"`
+	Key     string          `json:"key"`
+	Value   string          `json:"value,omitempty"`
+	Entries []SkipListEntry `json:"entries,omitempty"`
+	// TTL is the remaining time to live in milliseconds. Keys in this store
+	// never expire, so exports leave it out and imports reject records that
+	// set it.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// SkipListEntry is one element of a skip list in a Record.
+type SkipListEntry struct {
+	Key   int    `json:"key"`
+	Value string `json:"value"`
+}
+
+// ImportMode decides what ImportDomain does with keys already in the domain.
+type ImportMode string
+
+const (
+	// ImportMerge keeps the existing keys; records replace keys of the same
+	// name and type.
+	ImportMerge ImportMode = "merge"
+	// ImportOverwrite empties the domain before importing.
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// exportBatch is how many strings an export copies per hold of the
+// domain's read lock.
+const exportBatch = 256
+
+// ExportDomain writes a domain to w as newline-delimited JSON Records: the
+// strings in key order, then the skip lists in key order. Rather than
+// copying the whole domain first, it walks the keys like Scan, copying a
+// batch of strings or a single skip list at a time under read locks and
+// writing it out with no lock held. Every record is consistent and keys
+// that exist throughout are exported exactly once, but keys written during
+// the export may or may not appear.
+func (s *Store) ExportDomain(domain string, w io.Writer) error {
+	d, err := s.domain(domain)
+	if err != nil {
+		return err
+	}
+	return d.export(w)
+}
+
+// export writes the domain to w as ExportDomain describes.
+func (d *Domain) export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	records := make([]Record, 0, exportBatch)
+	after, started := "", false
+	for {
+		records = records[:0]
+		d.mu.RLock()
+		for x := d.stringKeys.after(after, started); x != nil && len(records) < exportBatch; x = x.next[0] {
+			records = append(records, Record{Type: "string", Key: x.key, Value: d.stringStore[x.key]})
+		}
+		d.mu.RUnlock()
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		after, started = records[len(records)-1].Key, true
+	}
+
+	after, started = "", false
+	for {
+		var sl *SkipList
+		d.mu.RLock()
+		if x := d.skipListKeys.after(after, started); x != nil {
+			after, started = x.key, true
+			sl = d.skipListStore[x.key]
+		}
+		d.mu.RUnlock()
+		if sl == nil {
+			return nil
+		}
+
+		sl.mu.RLock()
+		if sl.dropped {
+			sl.mu.RUnlock()
+			continue
+		}
+		record := Record{Type: "skiplist", Key: after, Entries: make([]SkipListEntry, 0, sl.Len())}
+		for x := sl.header.forward[0]; x != nil; x = x.forward[0] {
+			record.Entries = append(record.Entries, SkipListEntry{Key: x.key, Value: x.value})
+		}
+		sl.mu.RUnlock()
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportDomain reads newline-delimited JSON Records from r into a domain,
+// creating the domain if it does not exist, and returns the number of
+// records imported. Writes are subject to the domain's limits and memory
+// budget like any other. All records are read and checked before any is
+// stored, so a bad record leaves the domain as it was.
+func (s *Store) ImportDomain(domain string, r io.Reader, mode ImportMode) (int, error) {
+	switch mode {
+	case "", ImportMerge, ImportOverwrite:
+	default:
+		return 0, fmt.Errorf("unknown import mode %q", mode)
+	}
+
+	if _, err := s.lookupDomain(domain); err != nil {
+		s.ensureDomain(domain)
+	}
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
+	return d.importRecords(r, mode)
+}
+
+// importSet holds the records of an import, checked against the domain's
+// limits but not stored yet. Later records replace earlier ones of the same
+// key and type, and an empty skip list stands for deleting the list.
+type importSet struct {
+	strings   map[string]string
+	skipLists map[string]*SkipList
+}
+
+// importRecords reads Records from r into the domain as ImportDomain
+// describes.
+func (d *Domain) importRecords(r io.Reader, mode ImportMode) (int, error) {
+	set := importSet{strings: make(map[string]string), skipLists: make(map[string]*SkipList)}
+	limits := d.limits.Load()
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var record Record
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := d.stageRecord(&set, limits, record); err != nil {
+			return 0, fmt.Errorf("record %d: %v", n+1, err)
+		}
+		n++
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.applyImport(&set, limits, mode == ImportOverwrite); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// stageRecord checks one Record against limits and adds it to set.
+func (d *Domain) stageRecord(set *importSet, limits *Limits, record Record) error {
+	if record.TTL != 0 {
+		return fmt.Errorf("ttl is not supported")
+	}
+	if err := limits.checkKey(record.Key); err != nil {
+		return err
+	}
+
+	switch record.Type {
+	case "string":
+		if err := limits.checkValue(record.Value); err != nil {
+			return err
+		}
+		set.strings[record.Key] = record.Value
+	case "skiplist":
+		if limits.MaxSkipListLen > 0 && len(record.Entries) > limits.MaxSkipListLen {
+			return errSkipListLenLimit
+		}
+		sl := d.newSkipList()
+		for _, entry := range record.Entries {
+			if err := limits.checkValue(entry.Value); err != nil {
+				return err
+			}
+			sl.Insert(entry.Key, entry.Value)
+		}
+		set.skipLists[record.Key] = sl
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+	return nil
+}
+
+// applyImport stores set in the domain, first emptying it when overwrite
+// is set. It checks the key counts and memory the domain ends up with
+// before changing anything. d.mu must be held.
+func (d *Domain) applyImport(set *importSet, limits *Limits, overwrite bool) error {
+	strs, lists := len(d.stringStore), len(d.skipListStore)
+	var need int64
+	if overwrite {
+		strs, lists = 0, 0
+		need = -d.memory.used.Load()
+	}
+	for key, value := range set.strings {
+		need += stringSize(key, value)
+		if old, ok := d.stringStore[key]; ok && !overwrite {
+			need -= stringSize(key, old)
+		} else {
+			strs++
+		}
+	}
+	for slkey, sl := range set.skipLists {
+		if old, ok := d.skipListStore[slkey]; ok && !overwrite {
+			old.mu.RLock()
+			need -= skipListSize(slkey, old)
+			old.mu.RUnlock()
+			lists--
+		}
+		if sl.Len() > 0 {
+			need += skipListSize(slkey, sl)
+			lists++
+		}
+	}
+	if limits.MaxSkipLists > 0 && lists > limits.MaxSkipLists {
+		return errSkipListLimit
+	}
+	if limits.MaxKeys > 0 && strs+lists > limits.MaxKeys {
+		return errKeyLimit
+	}
+	if overwrite {
+		// Everything the domain could evict is replaced anyway, so the
+		// import has to fit as it is.
+		if !d.fits(need) {
+			return errOutOfMemory
+		}
+		for key := range d.access {
+			d.deleteKey(key)
+		}
+	} else if err := d.makeRoom(need); err != nil {
+		return err
+	}
+
+	for key, value := range set.strings {
+		d.putString(key, value)
+	}
+	for slkey, sl := range set.skipLists {
+		d.dropSkipList(slkey)
+		if sl.Len() > 0 {
+			d.putSkipList(slkey, sl)
+		}
+	}
+	return nil
+}
+
+// HandleExport serves GET requests with a domain query parameter, streaming
+// the domain as newline-delimited JSON.
+func (s *Store) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	domain := r.URL.Query().Get("domain")
+	if _, err := s.lookupDomain(domain); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := s.ExportDomain(domain, w); err != nil {
+		// Headers may be out already; all that is left is cutting the
+		// stream short.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleImport serves POST requests with domain and optional mode query
+// parameters, importing the newline-delimited JSON body. It answers with a
+// Response whose Value is the number of records imported. Bodies larger
+// than DefaultMaxMessageSize are refused, and so are bodies that are not
+// application/x-ndjson or application/json, which keeps HTML forms on
+// other sites from posting imports.
+func (s *Store) HandleImport(w http.ResponseWriter, r *http.Request) {
+	s.importHandler(DefaultMaxMessageSize)(w, r)
+}
+
+// importHandler is HandleImport with a limit of maxBytes on the body; 0
+// means no limit.
+func (s *Store) importHandler(maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/x-ndjson" && mediaType != "application/json" {
+			http.Error(w, "content type must be application/x-ndjson or application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		body := r.Body
+		if maxBytes > 0 {
+			body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		query := r.URL.Query()
+		n, err := s.ImportDomain(query.Get("domain"), body, ImportMode(query.Get("mode")))
+		resp := Response{Status: "success", Value: strconv.Itoa(n)}
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			resp = errorResponse(err)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// errExportTooLarge is returned by the export_domain action for domains that
+// do not fit in one message; the HTTP export endpoint streams any size.
+var errExportTooLarge = fmt.Errorf("export exceeds %d bytes, use the HTTP export endpoint", DefaultMaxMessageSize)
+
+// limitedWriter passes writes to w until more than n bytes in total were
+// written, then fails with errExportTooLarge.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errExportTooLarge
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
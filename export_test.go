@@ -0,0 +1,158 @@
+package kvs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("src")
+	assert.NoError(t, store.SetString("src", "b", "2"))
+	assert.NoError(t, store.SetString("src", "a", "1"))
+	assert.NoError(t, store.InsertToSkipList("src", "l", "2", "two"))
+	assert.NoError(t, store.InsertToSkipList("src", "l", "1", "one"))
+
+	var buf strings.Builder
+	assert.NoError(t, store.ExportDomain("src", &buf))
+	assert.Equal(t, `{"type":"string","key":"a","value":"1"}
+{"type":"string","key":"b","value":"2"}
+{"type":"skiplist","key":"l","entries":[{"key":1,"value":"one"},{"key":2,"value":"two"}]}
+`, buf.String())
+
+	// Merge keeps keys missing from the stream and replaces the others
+	store.CreateDomain("dst")
+	assert.NoError(t, store.SetString("dst", "a", "old"))
+	assert.NoError(t, store.SetString("dst", "c", "3"))
+	assert.NoError(t, store.InsertToSkipList("dst", "l", "9", "nine"))
+	n, err := store.ImportDomain("dst", strings.NewReader(buf.String()), ImportMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	value, _ := store.GetString("dst", "a")
+	assert.Equal(t, "1", value)
+	value, _ = store.GetString("dst", "c")
+	assert.Equal(t, "3", value)
+	_, err = store.SearchInSkipList("dst", "l", "9")
+	assert.Error(t, err)
+	rank, _ := store.RankInSkipList("dst", "l", "3")
+	assert.Equal(t, "2", rank)
+
+	// Overwrite drops everything else
+	n, err = store.ImportDomain("dst", strings.NewReader(buf.String()), ImportOverwrite)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	exists, _ := store.Exists("dst", []string{"c"})
+	assert.Equal(t, 0, exists)
+
+	n, err = store.ImportDomain("dst", strings.NewReader(`{"type":"string","key":"x","value":"1"}
+{"type":"string","key":"y","value":"1","ttl":1000}
+`), ImportMerge)
+	assert.EqualError(t, err, "record 2: ttl is not supported")
+	assert.Equal(t, 0, n)
+	exists, _ = store.Exists("dst", []string{"x"})
+	assert.Equal(t, 0, exists)
+
+	// A bad record or a limit the result would break leaves the domain as
+	// it was, even when overwriting
+	_, err = store.ImportDomain("dst", strings.NewReader(`{"type":"string","key":"x","value":"1"}
+{"type":"string","key":"y"`), ImportOverwrite)
+	assert.Error(t, err)
+	assert.NoError(t, store.SetLimits("dst", Limits{MaxKeys: 3}))
+	_, err = store.ImportDomain("dst", strings.NewReader(`{"type":"string","key":"x","value":"1"}`), ImportMerge)
+	assert.Equal(t, errKeyLimit, err)
+	n, err = store.ImportDomain("dst", strings.NewReader(`{"type":"string","key":"x","value":"1"}`), ImportOverwrite)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	exists, _ = store.Exists("dst", []string{"a", "b", "l", "x"})
+	assert.Equal(t, 1, exists)
+	assert.NoError(t, store.ConfigureMemory("dst", "1", ""))
+	_, err = store.ImportDomain("dst", strings.NewReader(`{"type":"string","key":"y","value":"1"}`), ImportOverwrite)
+	assert.Equal(t, errOutOfMemory, err)
+	exists, _ = store.Exists("dst", []string{"x"})
+	assert.Equal(t, 1, exists)
+
+	_, err = store.ImportDomain("dst", strings.NewReader(`{"type":"hash","key":"x"}`), ImportMerge)
+	assert.EqualError(t, err, `record 1: unknown record type "hash"`)
+	_, err = store.ImportDomain("dst", strings.NewReader(""), "append")
+	assert.EqualError(t, err, `unknown import mode "append"`)
+
+	// Over HTTP, importing into a domain that does not exist yet
+	export := httptest.NewServer(http.HandlerFunc(store.HandleExport))
+	defer export.Close()
+	imp := httptest.NewServer(http.HandlerFunc(store.HandleImport))
+	defer imp.Close()
+
+	res, err := http.Get(export.URL + "?domain=src")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+	res, err = http.Post(imp.URL+"?domain=copy&mode=overwrite", "application/x-ndjson", res.Body)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	var resp Response
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+	assert.Equal(t, Response{Status: "success", Value: "3"}, resp)
+	value, _ = store.SearchInSkipList("copy", "l", "2")
+	assert.Equal(t, "two", value)
+
+	res, err = http.Get(export.URL + "?domain=missing")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// Bodies a form could send are refused
+	res, err = http.Post(imp.URL+"?domain=copy&mode=overwrite", "application/x-www-form-urlencoded", strings.NewReader("a=b"))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	value, _ = store.SearchInSkipList("copy", "l", "2")
+	assert.Equal(t, "two", value)
+
+	// Bodies over the size limit are refused
+	small := httptest.NewServer(store.importHandler(16))
+	defer small.Close()
+	res, err = http.Post(small.URL+"?domain=copy", "application/x-ndjson", strings.NewReader(`{"type":"string","key":"big","value":"1"}`))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	exists, _ = store.Exists("copy", []string{"big"})
+	assert.Equal(t, 0, exists)
+}
+
+func TestExportBatches(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	n := 2*exportBatch + 10
+	for i := 0; i < n; i++ {
+		assert.NoError(t, store.SetString("test_domain", fmt.Sprintf("k%04d", i), "v"))
+	}
+	assert.NoError(t, store.InsertToSkipList("test_domain", "a", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "b", "1", "one"))
+
+	var buf strings.Builder
+	assert.NoError(t, store.ExportDomain("test_domain", &buf))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, n+2)
+	assert.Equal(t, `{"type":"string","key":"k0000","value":"v"}`, lines[0])
+	assert.Equal(t, fmt.Sprintf(`{"type":"string","key":"k%04d","value":"v"}`, n-1), lines[n-1])
+	assert.Equal(t, `{"type":"skiplist","key":"b","entries":[{"key":1,"value":"one"}]}`, lines[n+1])
+}
+
+func TestExportTooLarge(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	value := strings.Repeat("x", DefaultMaxMessageSize/2)
+	assert.NoError(t, store.SetString("test_domain", "a", value))
+
+	resp := store.handleRequest(Request{Action: "export_domain", Domain: "test_domain"})
+	assert.Equal(t, "success", resp.Status)
+	assert.NoError(t, store.SetString("test_domain", "b", value))
+	resp = store.handleRequest(Request{Action: "export_domain", Domain: "test_domain"})
+	assert.Equal(t, Response{Status: "error", Message: errExportTooLarge.Error()}, resp)
+}
@@ -0,0 +1,101 @@
+package kvs
+
+import "math/rand"
+
+const (
+	keyIndexMaxLevel = 32
+	keyIndexP        = 0.25
+)
+
+// keyIndex is an ordered set of strings kept next to a map so the map's
+// keys can be read in lexicographic order. It is a skip list like SkipList,
+// without values or spans.
+type keyIndex struct {
+	head   *keyNode
+	level  int
+	length int
+}
+
+type keyNode struct {
+	key  string
+	next []*keyNode
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  &keyNode{next: make([]*keyNode, keyIndexMaxLevel)},
+		level: 1,
+	}
+}
+
+// search fills update with the last node before key on every level and
+// returns the first node at or after key.
+func (ix *keyIndex) search(key string, update []*keyNode) *keyNode {
+	x := ix.head
+	for i := ix.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+func (ix *keyIndex) insert(key string) {
+	update := make([]*keyNode, keyIndexMaxLevel)
+	if x := ix.search(key, update); x != nil && x.key == key {
+		return
+	}
+
+	level := 1
+	for rand.Float32() < keyIndexP && level < keyIndexMaxLevel {
+		level++
+	}
+	for i := ix.level; i < level; i++ {
+		update[i] = ix.head
+	}
+	ix.level = max(ix.level, level)
+
+	node := &keyNode{key: key, next: make([]*keyNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	ix.length++
+}
+
+func (ix *keyIndex) delete(key string) {
+	update := make([]*keyNode, keyIndexMaxLevel)
+	x := ix.search(key, update)
+	if x == nil || x.key != key {
+		return
+	}
+
+	for i := range x.next {
+		update[i].next[i] = x.next[i]
+	}
+	for ix.level > 1 && ix.head.next[ix.level-1] == nil {
+		ix.level--
+	}
+	ix.length--
+}
+
+// seek returns the first node whose key is at least key.
+func (ix *keyIndex) seek(key string) *keyNode {
+	return ix.search(key, nil)
+}
+
+// after returns the first node whose key comes after key, or the first node
+// of all when started is not set.
+func (ix *keyIndex) after(key string, started bool) *keyNode {
+	if !started {
+		return ix.head.next[0]
+	}
+	x := ix.seek(key)
+	if x != nil && x.key == key {
+		x = x.next[0]
+	}
+	return x
+}
@@ -0,0 +1,86 @@
+package kvs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyOperations(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	assert.NoError(t, store.SetString("test_domain", "s", "value"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "2", "two"))
+
+	for key, expected := range map[string]string{"s": "string", "l": "skiplist", "x": "none"} {
+		typ, err := store.Type("test_domain", key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, typ, "Type(%s)", key)
+	}
+
+	n, err := store.Exists("test_domain", []string{"s", "l", "x", "s"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// Copy deep-copies skip lists
+	copied, err := store.Copy("test_domain", "l", "l2", false)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+	assert.NoError(t, store.DeleteFromSkipList("test_domain", "l2", "1"))
+	value, err := store.SearchInSkipList("test_domain", "l", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "one", value)
+
+	copied, err = store.Copy("test_domain", "s", "l2", false)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	copied, err = store.Copy("test_domain", "s", "l2", true)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+	typ, _ := store.Type("test_domain", "l2")
+	assert.Equal(t, "string", typ)
+
+	// Rename
+	renamed, err := store.RenameNX("test_domain", "s", "l2")
+	assert.NoError(t, err)
+	assert.False(t, renamed)
+	assert.NoError(t, store.Rename("test_domain", "l", "ranked"))
+	typ, _ = store.Type("test_domain", "l")
+	assert.Equal(t, "none", typ)
+	rank, err := store.RankInSkipList("test_domain", "ranked", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", rank)
+	assert.EqualError(t, store.Rename("test_domain", "missing", "other"), "key not found")
+
+	// Del counts existing keys only
+	n, err = store.Del("test_domain", []string{"s", "ranked", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	typ, err = store.Type("test_domain", "ranked")
+	assert.NoError(t, err)
+	assert.Equal(t, "none", typ)
+
+	// Removing the last element drops the list
+	assert.NoError(t, store.InsertToSkipList("test_domain", "tmp", "1", "one"))
+	assert.NoError(t, store.DeleteFromSkipList("test_domain", "tmp", "1"))
+	typ, _ = store.Type("test_domain", "tmp")
+	assert.Equal(t, "none", typ)
+
+	// and a missing list acts like an empty one
+	_, err = store.SearchInSkipList("test_domain", "tmp", "1")
+	assert.EqualError(t, err, "key not found")
+	rank, err = store.RankInSkipList("test_domain", "tmp", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", rank)
+	assert.NoError(t, store.DeleteFromSkipList("test_domain", "tmp", "1"))
+	n, err = store.DeleteRangeFromSkipList("test_domain", "tmp", "0", "10")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = store.DeleteRankRangeFromSkipList("test_domain", "tmp", "0", "-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	info, err := store.DebugSkipList("test_domain", "tmp", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, info.Length)
+}
@@ -0,0 +1,161 @@
+package kvs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits are the quotas of a Domain. Zero values mean unlimited.
+type Limits struct {
+	// MaxKeys caps the number of string keys and skip lists together.
+	MaxKeys int `json:"max_keys,omitempty" yaml:"max_keys,omitempty"`
+	// MaxSkipLists caps the number of skip lists.
+	MaxSkipLists int `json:"max_skiplists,omitempty" yaml:"max_skiplists,omitempty"`
+	// MaxSkipListLen caps the number of elements in each skip list.
+	MaxSkipListLen int `json:"max_skiplist_len,omitempty" yaml:"max_skiplist_len,omitempty"`
+	// MaxKeySize and MaxValueSize cap the length in bytes of keys, skip list
+	// keys included, and of values.
+	MaxKeySize   int `json:"max_key_size,omitempty" yaml:"max_key_size,omitempty"`
+	MaxValueSize int `json:"max_value_size,omitempty" yaml:"max_value_size,omitempty"`
+	// RequestsPerSecond caps the rate of operations on the domain, allowing
+	// bursts of up to Burst operations.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty" yaml:"requests_per_second,omitempty"`
+	Burst             int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+var (
+	errKeyLimit         = errors.New("domain key limit reached")
+	errSkipListLimit    = errors.New("domain skip list limit reached")
+	errSkipListLenLimit = errors.New("skip list length limit reached")
+	errKeySize          = errors.New("key exceeds maximum size")
+	errValueSize        = errors.New("value exceeds maximum size")
+	errRateLimited      = errors.New("request rate limit exceeded")
+)
+
+func (l *Limits) validate() error {
+	if l.MaxKeys < 0 || l.MaxSkipLists < 0 || l.MaxSkipListLen < 0 || l.MaxKeySize < 0 ||
+		l.MaxValueSize < 0 || l.RequestsPerSecond < 0 || l.Burst < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+func (l *Limits) checkKey(key string) error {
+	if l.MaxKeySize > 0 && len(key) > l.MaxKeySize {
+		return errKeySize
+	}
+	return nil
+}
+
+func (l *Limits) checkValue(value string) error {
+	if l.MaxValueSize > 0 && len(value) > l.MaxValueSize {
+		return errValueSize
+	}
+	return nil
+}
+
+// checkNewKeys reports whether n more keys fit in the domain. d.mu must be
+// held.
+func (d *Domain) checkNewKeys(n int) error {
+	limits := d.limits.Load()
+	if limits.MaxKeys > 0 && len(d.stringStore)+len(d.skipListStore)+n > limits.MaxKeys {
+		return errKeyLimit
+	}
+	return nil
+}
+
+// checkString validates setting key to value against the domain's limits.
+// d.mu must be held.
+func (d *Domain) checkString(key, value string) error {
+	limits := d.limits.Load()
+	if err := limits.checkKey(key); err != nil {
+		return err
+	}
+	if err := limits.checkValue(value); err != nil {
+		return err
+	}
+	if _, ok := d.stringStore[key]; !ok {
+		return d.checkNewKeys(1)
+	}
+	return nil
+}
+
+// checkStrings validates setting each of keys to the matching value against
+// the domain's limits. d.mu must be held.
+func (d *Domain) checkStrings(keys, values []string) error {
+	limits := d.limits.Load()
+	added := make(map[string]bool)
+	for i, key := range keys {
+		if err := limits.checkKey(key); err != nil {
+			return err
+		}
+		if err := limits.checkValue(values[i]); err != nil {
+			return err
+		}
+		if _, ok := d.stringStore[key]; !ok {
+			added[key] = true
+		}
+	}
+	return d.checkNewKeys(len(added))
+}
+
+// checkNewSkipList validates creating a skip list under slkey against the
+// domain's limits. d.mu must be held.
+func (d *Domain) checkNewSkipList(slkey string) error {
+	limits := d.limits.Load()
+	if err := limits.checkKey(slkey); err != nil {
+		return err
+	}
+	if limits.MaxSkipLists > 0 && len(d.skipListStore) >= limits.MaxSkipLists {
+		return errSkipListLimit
+	}
+	return d.checkNewKeys(1)
+}
+
+// allow takes a token from the domain's request rate limiter, if any.
+func (d *Domain) allow() error {
+	return d.limiter.Load().take("domain")
+}
+
+// CreateDomainWithLimits creates a domain with the given quotas.
+func (s *Store) CreateDomainWithLimits(name string, limits Limits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	s.CreateDomain(name)
+	return s.SetLimits(name, limits)
+}
+
+// SetLimits replaces the quotas of a domain. Lowering a limit below the
+// current usage does not remove anything; it only rejects further growth.
+func (s *Store) SetLimits(domain string, limits Limits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	d, err := s.lookupDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	d.setLimits(limits)
+	return nil
+}
+
+func (d *Domain) setLimits(limits Limits) {
+	d.limits.Store(&limits)
+	if limits.RequestsPerSecond > 0 {
+		d.limiter.Store(newTokenBucket(limits.RequestsPerSecond, limits.Burst))
+	} else {
+		d.limiter.Store(nil)
+	}
+}
+
+// Limits returns the quotas of a domain.
+func (s *Store) Limits(domain string) (*Limits, error) {
+	d, err := s.lookupDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	limits := *d.limits.Load()
+	return &limits, nil
+}
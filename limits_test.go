@@ -0,0 +1,64 @@
+package kvs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	store := NewStore()
+	assert.EqualError(t, store.CreateDomainWithLimits("test_domain", Limits{MaxKeys: -1}), "limits must not be negative")
+	assert.NoError(t, store.CreateDomainWithLimits("test_domain", Limits{
+		MaxKeys:        4,
+		MaxSkipLists:   1,
+		MaxSkipListLen: 2,
+		MaxKeySize:     8,
+		MaxValueSize:   5,
+	}))
+
+	assert.Equal(t, errKeySize, store.SetString("test_domain", "long_key_name", "v"))
+	assert.Equal(t, errValueSize, store.SetString("test_domain", "k", "too long"))
+	_, err := store.Append("test_domain", "k", "123456")
+	assert.Equal(t, errValueSize, err)
+
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "2", "two"))
+	assert.Equal(t, errSkipListLenLimit, store.InsertToSkipList("test_domain", "l", "3", "three"))
+	assert.Equal(t, errSkipListLimit, store.InsertToSkipList("test_domain", "l2", "1", "one"))
+	_, err = store.Copy("test_domain", "l", "l2", false)
+	assert.Equal(t, errSkipListLimit, err)
+
+	assert.NoError(t, store.MSet("test_domain", []string{"a", "b"}, []string{"1", "2"}))
+	assert.NoError(t, store.SetString("test_domain", "c", "3"))
+	assert.Equal(t, errKeyLimit, store.SetString("test_domain", "d", "4"))
+	assert.Equal(t, errKeyLimit, store.MSet("test_domain", []string{"a", "d"}, []string{"1", "4"}))
+	assert.NoError(t, store.SetString("test_domain", "a", "10"))
+
+	// Raising the limits later lets the domain grow again
+	limits, err := store.Limits("test_domain")
+	assert.NoError(t, err)
+	limits.MaxKeys = 0
+	assert.NoError(t, store.SetLimits("test_domain", *limits))
+	assert.NoError(t, store.SetString("test_domain", "d", "4"))
+}
+
+func TestDomainRateLimit(t *testing.T) {
+	store := NewStore()
+	assert.NoError(t, store.CreateDomainWithLimits("test_domain", Limits{RequestsPerSecond: 1, Burst: 3}))
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.SetString("test_domain", "k", "v"))
+	}
+	_, err := store.GetString("test_domain", "k")
+	assert.ErrorIs(t, err, errRateLimited)
+	assert.EqualError(t, err, "domain request rate limit exceeded")
+	resp := errorResponse(err)
+	assert.Equal(t, "rate_limited", resp.Status)
+	assert.InDelta(t, 1000, resp.RetryAfterMs, 100)
+
+	// Admin actions are not rate limited, so the limit can be lifted
+	assert.NoError(t, store.SetLimits("test_domain", Limits{}))
+	_, err = store.GetString("test_domain", "k")
+	assert.NoError(t, err)
+}
@@ -3,6 +3,9 @@ package kvs
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -278,4 +281,414 @@ func TestSkipListRank2(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// TestConcurrentInsert hammers one list from many goroutines through Store;
+// run with -race to check the per-list locking.
+func TestConcurrentInsert(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := strconv.Itoa(g*100 + i)
+				if err := store.InsertToSkipList("test_domain", "test_sl", key, "value"+key); err != nil {
+					t.Errorf("InsertToSkipList(%s): %v", key, err)
+				}
+				if err := store.SetString("test_domain", key, key); err != nil {
+					t.Errorf("SetString(%s): %v", key, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for i := 0; i < 800; i++ {
+		key := strconv.Itoa(i)
+		value, err := store.SearchInSkipList("test_domain", "test_sl", key)
+		if err != nil || value != "value"+key {
+			t.Errorf("SearchInSkipList(%s) = %q, %v; want %q", key, value, err, "value"+key)
+		}
+	}
+	rank, err := store.RankInSkipList("test_domain", "test_sl", "800")
+	if err != nil || rank != "800" {
+		t.Errorf("RankInSkipList(800) = %q, %v; want 800", rank, err)
+	}
+}
+
+// benchmarkLists is the number of lists written to in the contention
+// benchmarks; each parallel worker picks one.
+const benchmarkLists = 8
+
+// BenchmarkInsertDomainLock measures parallel inserts into several lists of
+// one domain when a single mutex guards the whole domain, which is how Store
+// used to serialize skip list writes.
+func BenchmarkInsertDomainLock(b *testing.B) {
+	var mu sync.Mutex
+	benchmarkInsert(b, mu.Lock, mu.Unlock)
+}
+
+// BenchmarkInsertListLock measures the same workload with only the per-list
+// locks Store takes itself.
+func BenchmarkInsertListLock(b *testing.B) {
+	benchmarkInsert(b, func() {}, func() {})
+}
+
+// benchmarkInsert runs parallel inserts through Store, each worker writing
+// to one of benchmarkLists lists of one domain, with every insert wrapped in
+// lock and unlock.
+func benchmarkInsert(b *testing.B, lock, unlock func()) {
+	store := NewStore()
+	store.CreateDomain("bench")
+
+	var worker atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(worker.Add(1))
+		slkey := "list" + strconv.Itoa(id%benchmarkLists)
+		key := id << 32
+		for pb.Next() {
+			key++
+			lock()
+			err := store.InsertToSkipList("bench", slkey, strconv.Itoa(key), "value")
+			unlock()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestSeededStructure checks that lists built from the same seed have the
+// same shape, node for node.
+func TestSeededStructure(t *testing.T) {
+	build := func() *SkipList {
+		sl := NewSkipList(WithRand(rand.New(rand.NewSource(42))))
+		for i := 0; i < 1000; i++ {
+			sl.Insert(i, "value"+strconv.Itoa(i))
+		}
+		return sl
+	}
+	a, b := build(), build()
+
+	if a.level != b.level {
+		t.Fatalf("levels differ: %d vs %d", a.level, b.level)
+	}
+	x, y := a.header.forward[0], b.header.forward[0]
+	for x != nil && y != nil {
+		if x.key != y.key || len(x.forward) != len(y.forward) {
+			t.Fatalf("node %d has %d levels in one list and node %d has %d in the other", x.key, len(x.forward), y.key, len(y.forward))
+		}
+		x, y = x.forward[0], y.forward[0]
+	}
+	if x != nil || y != nil {
+		t.Fatal("lists have different lengths")
+	}
+}
+
+// TestConfigureSkipLists checks that a domain creates its lists with the
+// configured parameters and refuses invalid ones.
+func TestConfigureSkipLists(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	for _, config := range []SkipListConfig{{MaxLevel: -1}, {MaxLevel: 65}, {P: 1}, {P: -0.5}} {
+		if err := store.ConfigureSkipLists("test_domain", config); err == nil {
+			t.Errorf("ConfigureSkipLists(%+v) succeeded", config)
+		}
+	}
+	if err := store.ConfigureSkipLists("missing", SkipListConfig{}); err == nil {
+		t.Errorf("ConfigureSkipLists on a missing domain succeeded")
+	}
+
+	if err := store.ConfigureSkipLists("test_domain", SkipListConfig{MaxLevel: 24, P: 0.25}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertToSkipList("test_domain", "l", "1", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CloneDomain("test_domain", "clone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertToSkipList("clone", "other", "1", "one"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test_domain", "clone"} {
+		for slkey, sl := range store.domains[name].skipListStore {
+			if sl.maxLevel != 24 || sl.p != 0.25 {
+				t.Errorf("%s/%s has max level %d and p %v; want 24 and 0.25", name, slkey, sl.maxLevel, sl.p)
+			}
+		}
+	}
+}
+
+func TestSkipListOptions(t *testing.T) {
+	sl := NewSkipList(WithRand(rand.New(rand.NewSource(1))), WithMaxLevel(4), WithP(0.75))
+	for i := 0; i < 1000; i++ {
+		sl.Insert(i, "value")
+	}
+	if sl.level > 4 {
+		t.Errorf("level = %d; want at most 4", sl.level)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, found := sl.Search(i); !found {
+			t.Errorf("Search(%d) not found", i)
+		}
+	}
+	if rank := sl.Rank(500); rank != 500 {
+		t.Errorf("Rank(500) = %d; want 500", rank)
+	}
+
+	tests := []struct {
+		n        int
+		p        float32
+		expected int
+	}{
+		{1, 0.5, 1},
+		{65536, 0.5, 16},
+		{65537, 0.5, 17},
+		{10000000, 0.5, 24},
+		{10000000, 0.25, 12},
+	}
+	for _, test := range tests {
+		if level := MaxLevelFor(test.n, test.p); level != test.expected {
+			t.Errorf("MaxLevelFor(%d, %v) = %d; want %d", test.n, test.p, level, test.expected)
+		}
+	}
+}
+
+func TestDeleteRangeCount(t *testing.T) {
+	sl := NewSkipList(WithRand(rand.New(rand.NewSource(7))))
+	for i := 1; i <= 9; i++ {
+		sl.Insert(i, "value"+strconv.Itoa(i))
+	}
+
+	if removed := sl.DeleteRange(3, 5); removed != 3 {
+		t.Errorf("DeleteRange(3, 5) = %d; want 3", removed)
+	}
+	values := sl.DeleteRangeValues(0, 6)
+	if fmt.Sprint(values) != "[value1 value2 value6]" {
+		t.Errorf("DeleteRangeValues(0, 6) = %v; want [value1 value2 value6]", values)
+	}
+	if removed := sl.DeleteRange(20, 30); removed != 0 {
+		t.Errorf("DeleteRange(20, 30) = %d; want 0", removed)
+	}
+	if sl.Len() != 3 {
+		t.Errorf("Len() = %d; want 3", sl.Len())
+	}
+}
+
+// TestRankAfterDeletes checks that spans stay consistent when nodes are
+// removed one at a time and in ranges.
+func TestRankAfterDeletes(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	sl := NewSkipList(WithRand(r))
+	present := make(map[int]bool)
+	for i := 0; i < 2000; i++ {
+		key := r.Intn(1000)
+		if !present[key] {
+			sl.Insert(key, "value")
+			present[key] = true
+		}
+	}
+	for i := 0; i < 300; i++ {
+		key := r.Intn(1000)
+		sl.Delete(key)
+		delete(present, key)
+	}
+	for i := 0; i < 10; i++ {
+		start := r.Intn(1000)
+		end := start + r.Intn(30)
+		removed := sl.DeleteRange(start, end)
+		want := 0
+		for key := start; key <= end; key++ {
+			if present[key] {
+				want++
+				delete(present, key)
+			}
+		}
+		if removed != want {
+			t.Errorf("DeleteRange(%d, %d) = %d; want %d", start, end, removed, want)
+		}
+	}
+
+	if sl.Len() != len(present) {
+		t.Errorf("Len() = %d; want %d", sl.Len(), len(present))
+	}
+	expected := 0
+	for key := 0; key <= 1000; key++ {
+		if rank := sl.Rank(key); rank != expected {
+			t.Fatalf("Rank(%d) = %d; want %d", key, rank, expected)
+		}
+		if present[key] {
+			expected++
+		}
+	}
+}
+
+func TestDeleteRangeByRank(t *testing.T) {
+	tests := []struct {
+		start, stop int
+		removed     int
+		remaining   string
+	}{
+		{0, 2, 3, "[4 5 6 7 8 9]"},
+		{-3, -1, 3, "[1 2 3 4 5 6]"},
+		{0, -4, 6, "[7 8 9]"},
+		{3, 3, 1, "[1 2 3 5 6 7 8 9]"},
+		{5, 100, 4, "[1 2 3 4 5]"},
+		{-100, 0, 1, "[2 3 4 5 6 7 8 9]"},
+		{6, 2, 0, "[1 2 3 4 5 6 7 8 9]"},
+		{9, 12, 0, "[1 2 3 4 5 6 7 8 9]"},
+	}
+
+	for _, test := range tests {
+		sl := NewSkipList()
+		for i := 1; i <= 9; i++ {
+			sl.Insert(i, "value")
+		}
+
+		removed := sl.DeleteRangeByRank(test.start, test.stop)
+		var keys []int
+		for x := sl.header.forward[0]; x != nil; x = x.forward[0] {
+			keys = append(keys, x.key)
+		}
+		if removed != test.removed || fmt.Sprint(keys) != test.remaining {
+			t.Errorf("DeleteRangeByRank(%d, %d) = %d leaving %v; want %d leaving %s", test.start, test.stop, removed, keys, test.removed, test.remaining)
+		}
+		for i, key := range keys {
+			if rank := sl.Rank(key); rank != i {
+				t.Errorf("after DeleteRangeByRank(%d, %d): Rank(%d) = %d; want %d", test.start, test.stop, key, rank, i)
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	sl := NewSkipList(WithRand(rand.New(rand.NewSource(5))))
+	for i := 1; i <= 20; i++ {
+		sl.Insert(i, "value")
+	}
+
+	info := sl.Describe(true)
+	if info.Length != 20 || info.Level != sl.level || len(info.Levels) != sl.level {
+		t.Fatalf("Describe() = %+v; want length 20 and %d levels", info, sl.level)
+	}
+	if info.Levels[0].Nodes != 20 || len(info.Levels[0].Keys) != 20 || len(info.Levels[0].Spans) != 21 {
+		t.Errorf("level 1 = %+v; want 20 nodes with keys and 21 spans", info.Levels[0])
+	}
+	for i := 1; i < len(info.Levels); i++ {
+		if info.Levels[i].Nodes > info.Levels[i-1].Nodes {
+			t.Errorf("level %d has more nodes than level %d", i+1, i)
+		}
+	}
+	if info.MemoryBytes <= 20*len("value") {
+		t.Errorf("MemoryBytes = %d; want more than the values alone", info.MemoryBytes)
+	}
+	if brief := sl.Describe(false); brief.Levels[0].Keys != nil || brief.Levels[0].Spans != nil {
+		t.Errorf("Describe(false) listed keys or spans: %+v", brief.Levels[0])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	sl := NewSkipList(WithRand(r))
+	for i := 0; i < 5000; i++ {
+		switch key := r.Intn(500); r.Intn(4) {
+		case 0:
+			sl.Delete(key)
+		case 1:
+			sl.DeleteRange(key, key+r.Intn(10))
+		case 2:
+			sl.DeleteRangeByRank(r.Intn(50), r.Intn(50))
+		default:
+			sl.Insert(key, "value")
+		}
+		if err := sl.Validate(); err != nil {
+			t.Fatalf("after %d operations: %v", i+1, err)
+		}
+	}
+
+	// Corrupt a span and make sure it is reported.
+	sl.Insert(1000, "value")
+	sl.header.span[0]++
+	if err := sl.Validate(); err == nil {
+		t.Error("Validate() = nil for a corrupted span")
+	}
+	sl.header.span[0]--
+
+	// And a top level that skips a node, and a wrong length.
+	top := sl.level - 1
+	if x := sl.header.forward[top]; x != nil {
+		sl.header.forward[top] = x.forward[top]
+		if err := sl.Validate(); err == nil {
+			t.Error("Validate() = nil for a skipped node")
+		}
+		sl.header.forward[top] = x
+	}
+	sl.length++
+	if err := sl.Validate(); err == nil {
+		t.Error("Validate() = nil for a wrong length")
+	}
+}
+
+func TestClone(t *testing.T) {
+	sl := NewSkipList(WithRand(rand.New(rand.NewSource(9))))
+	for i := 0; i < 100; i++ {
+		sl.Insert(i, "value"+strconv.Itoa(i))
+	}
+
+	clone := sl.Clone()
+	if err := clone.Validate(); err != nil {
+		t.Fatalf("clone is inconsistent: %v", err)
+	}
+	if fmt.Sprint(clone.Describe(true)) != fmt.Sprint(sl.Describe(true)) {
+		t.Error("clone has a different structure")
+	}
+
+	clone.DeleteRange(0, 49)
+	clone.Insert(1000, "value1000")
+	if sl.Len() != 100 {
+		t.Errorf("Len() of original = %d after changing the clone; want 100", sl.Len())
+	}
+	if _, found := sl.Search(1000); found {
+		t.Error("insert into the clone is visible in the original")
+	}
+	if err := sl.Validate(); err != nil {
+		t.Errorf("original is inconsistent: %v", err)
+	}
+}
+
+func TestKeyIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	ix := newKeyIndex()
+	present := make(map[string]bool)
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(r.Intn(1000))
+		if r.Intn(3) == 0 {
+			ix.delete(key)
+			delete(present, key)
+		} else {
+			ix.insert(key)
+			present[key] = true
+		}
+	}
+
+	var keys []string
+	for x := ix.head.next[0]; x != nil; x = x.next[0] {
+		keys = append(keys, x.key)
+	}
+	if len(keys) != len(present) || ix.length != len(present) {
+		t.Fatalf("index holds %d keys with length %d; want %d", len(keys), ix.length, len(present))
+	}
+	for i, key := range keys {
+		if !present[key] || (i > 0 && keys[i-1] >= key) {
+			t.Fatalf("key %q at position %d is missing from the set or out of order", key, i)
+		}
+	}
+	if x := ix.seek("5"); x == nil || x.key < "5" {
+		t.Errorf("seek(5) = %v; want the first key at or after 5", x)
+	}
+}
@@ -0,0 +1,284 @@
+package kvs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// EvictionPolicy decides which keys a Domain drops when a write would take
+// it over its memory limit.
+type EvictionPolicy string
+
+const (
+	// NoEviction rejects writes that do not fit.
+	NoEviction EvictionPolicy = "noeviction"
+	// AllKeysLRU evicts the least recently used key.
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// AllKeysLFU evicts the least frequently used key. Use counts are not
+	// decayed, so keys that were hot long ago stay protected.
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// VolatileTTL evicts the key closest to expiring among keys with a time
+	// to live. Keys in this store never expire, so it currently behaves
+	// like NoEviction.
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+	// AllKeysRandom evicts an arbitrary key.
+	AllKeysRandom EvictionPolicy = "allkeys-random"
+)
+
+// evictionSamples is how many keys LRU and LFU eviction compare to pick a
+// victim, trading accuracy for not scanning the whole domain.
+const evictionSamples = 5
+
+// Approximate per-key overheads on top of the key and value bytes: the map
+// entries, the ordered key index node and the access record.
+const (
+	stringEntryBytes   = 112
+	skipListEntryBytes = 64
+	// skipListInsertBytes is what InsertToSkipList reserves for a node on
+	// top of its value, assuming the expected height of two levels.
+	skipListInsertBytes = nodeBytes + 2*(pointerBytes+spanBytes)
+)
+
+var errOutOfMemory = errors.New("memory limit reached and no key can be evicted")
+
+// memoryBudget counts bytes in use against an optional limit; a limit of 0
+// means unlimited.
+type memoryBudget struct {
+	used  atomic.Int64
+	limit atomic.Int64
+}
+
+// keyAccess records how recently and how often a key was used, for the
+// LRU and LFU policies. The map holding it is guarded by Domain.mu, its
+// fields are updated atomically so readers can record accesses.
+type keyAccess struct {
+	lastUsed atomic.Int64
+	hits     atomic.Int64
+}
+
+// MemoryStats reports the memory accounting of a Domain and of the Store it
+// belongs to.
+type MemoryStats struct {
+	Used       int64  `json:"used"`
+	Limit      int64  `json:"limit"`
+	Policy     string `json:"policy"`
+	Evicted    int64  `json:"evicted"`
+	StoreUsed  int64  `json:"store_used"`
+	StoreLimit int64  `json:"store_limit"`
+}
+
+func stringSize(key, value string) int64 {
+	return int64(stringEntryBytes + len(key) + len(value))
+}
+
+func skipListSize(key string, sl *SkipList) int64 {
+	return int64(skipListEntryBytes + len(key) + sl.bytes)
+}
+
+// keySize returns the bytes charged for what key holds. d.mu must be held.
+func (d *Domain) keySize(key string) int64 {
+	var size int64
+	if value, ok := d.stringStore[key]; ok {
+		size += stringSize(key, value)
+	}
+	if sl, ok := d.skipListStore[key]; ok {
+		sl.mu.RLock()
+		size += skipListSize(key, sl)
+		sl.mu.RUnlock()
+	}
+	return size
+}
+
+// charge adds delta bytes to the usage of the domain and its store.
+func (d *Domain) charge(delta int64) {
+	d.memory.used.Add(delta)
+	if store := d.storeMemory.Load(); store != nil {
+		store.used.Add(delta)
+	}
+}
+
+func (d *Domain) limited() bool {
+	store := d.storeMemory.Load()
+	return d.memory.limit.Load() > 0 || (store != nil && store.limit.Load() > 0)
+}
+
+// fits reports whether need more bytes stay within budget, and whether they
+// could fit at all if every key were evicted.
+func fits(b *memoryBudget, need int64) (bool, bool) {
+	limit := b.limit.Load()
+	if limit <= 0 {
+		return true, true
+	}
+	return b.used.Load()+need <= limit, need <= limit
+}
+
+// fits reports whether need more bytes stay within both the domain and the
+// store budget without evicting anything.
+func (d *Domain) fits(need int64) bool {
+	ok, _ := fits(&d.memory, need)
+	if store := d.storeMemory.Load(); store != nil {
+		storeOK, _ := fits(store, need)
+		ok = ok && storeOK
+	}
+	return ok
+}
+
+// makeRoom evicts keys according to the domain's policy until need more
+// bytes fit in both the domain and the store budget. When the store is over
+// budget the domain being written to gives up keys. d.mu must be held.
+func (d *Domain) makeRoom(need int64) error {
+	if need <= 0 || !d.limited() {
+		return nil
+	}
+	for {
+		ok, possible := fits(&d.memory, need)
+		if store := d.storeMemory.Load(); store != nil {
+			storeOK, storePossible := fits(store, need)
+			ok, possible = ok && storeOK, possible && storePossible
+		}
+		if ok {
+			return nil
+		}
+		if !possible || !d.evictOne() {
+			return errOutOfMemory
+		}
+	}
+}
+
+// reserve is makeRoom for writers that do not hold d.mu.
+func (d *Domain) reserve(need int64) error {
+	if !d.limited() {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.makeRoom(need)
+}
+
+// evictOne removes one key chosen by the eviction policy and reports
+// whether it found one. d.mu must be held.
+func (d *Domain) evictOne() bool {
+	var victim string
+	var best int64
+	found := false
+	sampled := 0
+	for key, a := range d.access {
+		var score int64
+		switch d.policy {
+		case AllKeysLRU:
+			score = a.lastUsed.Load()
+		case AllKeysLFU:
+			score = a.hits.Load()
+		case AllKeysRandom:
+		default:
+			return false
+		}
+		if !found || score < best {
+			victim, best, found = key, score, true
+		}
+		sampled++
+		if sampled == evictionSamples || d.policy == AllKeysRandom {
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	d.deleteKey(victim)
+	d.evicted.Add(1)
+	return true
+}
+
+// track starts recording accesses to key if it is new. d.mu must be held
+// for writing.
+func (d *Domain) track(key string) {
+	if _, ok := d.access[key]; !ok {
+		d.access[key] = &keyAccess{}
+	}
+	d.touch(key)
+}
+
+// untrack forgets key once nothing is stored under it. d.mu must be held
+// for writing.
+func (d *Domain) untrack(key string) {
+	if d.keyType(key) == "none" {
+		delete(d.access, key)
+	}
+}
+
+// touch records a use of key. d.mu must be held, for reading is enough.
+func (d *Domain) touch(key string) {
+	if a, ok := d.access[key]; ok {
+		a.lastUsed.Store(d.clock.Add(1))
+		a.hits.Add(1)
+	}
+}
+
+// SetMaxMemory limits the memory used by all domains together. Writes that
+// would exceed it evict keys from the domain being written to, following
+// that domain's policy. A limit of 0 removes the limit.
+func (s *Store) SetMaxMemory(limit int64) {
+	s.memory.limit.Store(max(limit, 0))
+}
+
+// ConfigureMemory sets the memory limit in bytes and the eviction policy of
+// a domain. Empty arguments leave the current setting unchanged and a limit
+// of 0 removes the limit. Keys have no time to live yet, so volatile-ttl
+// never finds a key to evict and rejects writes like noeviction.
+func (s *Store) ConfigureMemory(domain, maxMemory, policy string) error {
+	var limit int64
+	var err error
+	if maxMemory != "" {
+		if limit, err = strconv.ParseInt(maxMemory, 10, 64); err != nil || limit < 0 {
+			return fmt.Errorf("max_memory must be a non-negative integer")
+		}
+	}
+	switch EvictionPolicy(policy) {
+	case "", NoEviction, AllKeysLRU, AllKeysLFU, VolatileTTL, AllKeysRandom:
+	default:
+		return fmt.Errorf("unknown eviction policy %q", policy)
+	}
+
+	d, err := s.lookupDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if maxMemory != "" {
+		d.memory.limit.Store(limit)
+	}
+	if policy != "" {
+		d.policy = EvictionPolicy(policy)
+	}
+	// Shrink right away if the new limit is already exceeded; whatever
+	// cannot be evicted is left for writes to run into.
+	for limit := d.memory.limit.Load(); limit > 0 && d.memory.used.Load() > limit; {
+		if !d.evictOne() {
+			break
+		}
+	}
+	return nil
+}
+
+// MemoryStats returns the memory accounting of a domain.
+func (s *Store) MemoryStats(domain string) (*MemoryStats, error) {
+	d, err := s.lookupDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return &MemoryStats{
+		Used:       d.memory.used.Load(),
+		Limit:      d.memory.limit.Load(),
+		Policy:     string(d.policy),
+		Evicted:    d.evicted.Load(),
+		StoreUsed:  s.memory.used.Load(),
+		StoreLimit: s.memory.limit.Load(),
+	}, nil
+}
@@ -0,0 +1,133 @@
+package kvs
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+
+	assert.NoError(t, store.SetString("test_domain", "a", "value"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "2", "two"))
+	stats, err := store.MemoryStats("test_domain")
+	assert.NoError(t, err)
+	assert.Greater(t, stats.Used, int64(0))
+	assert.Equal(t, stats.Used, stats.StoreUsed)
+
+	_, err = store.Copy("test_domain", "l", "l2", false)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Rename("test_domain", "a", "renamed"))
+	_, err = store.DeleteRangeFromSkipList("test_domain", "l", "0", "10")
+	assert.NoError(t, err)
+	_, err = store.Del("test_domain", []string{"renamed", "l2"})
+	assert.NoError(t, err)
+
+	stats, err = store.MemoryStats("test_domain")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Used)
+	assert.Equal(t, int64(0), stats.StoreUsed)
+
+	// A replaced domain no longer counts against the store, even for
+	// writes that were under way when it was replaced
+	assert.NoError(t, store.SetString("test_domain", "a", "value"))
+	old, err := store.domain("test_domain")
+	assert.NoError(t, err)
+	store.CreateDomain("test_domain")
+	old.mu.Lock()
+	old.putString("b", "value")
+	old.deleteString("a")
+	old.mu.Unlock()
+	stats, err = store.MemoryStats("test_domain")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.StoreUsed)
+}
+
+func TestEviction(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	limit := 3 * stringSize("k0", "value")
+	assert.NoError(t, store.ConfigureMemory("test_domain", strconv.FormatInt(limit, 10), ""))
+
+	// noeviction rejects the write
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.SetString("test_domain", fmt.Sprintf("k%d", i), "value"))
+	}
+	assert.Equal(t, errOutOfMemory, store.SetString("test_domain", "k3", "value"))
+	assert.Equal(t, errOutOfMemory, store.MSet("test_domain", []string{"k3"}, []string{"value"}))
+
+	// volatile-ttl only evicts keys with a time to live, and no key has one
+	assert.NoError(t, store.ConfigureMemory("test_domain", "", "volatile-ttl"))
+	assert.Equal(t, errOutOfMemory, store.SetString("test_domain", "k3", "value"))
+
+	// allkeys-lru drops the key used longest ago
+	assert.NoError(t, store.ConfigureMemory("test_domain", "", "allkeys-lru"))
+	_, err := store.GetString("test_domain", "k0")
+	assert.NoError(t, err)
+	assert.NoError(t, store.SetString("test_domain", "k3", "value"))
+	n, err := store.Exists("test_domain", []string{"k0", "k1", "k2", "k3"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = store.GetString("test_domain", "k1")
+	assert.EqualError(t, err, "key not found")
+
+	// allkeys-lfu drops the key used least often
+	assert.NoError(t, store.ConfigureMemory("test_domain", "", "allkeys-lfu"))
+	for i := 0; i < 5; i++ {
+		store.GetString("test_domain", "k0")
+		store.GetString("test_domain", "k3")
+	}
+	assert.NoError(t, store.SetString("test_domain", "k4", "value"))
+	_, err = store.GetString("test_domain", "k2")
+	assert.EqualError(t, err, "key not found")
+
+	// A value larger than the whole budget is rejected without evicting
+	assert.Equal(t, errOutOfMemory, store.SetString("test_domain", "big", string(make([]byte, limit))))
+	n, _ = store.Exists("test_domain", []string{"k0", "k3", "k4"})
+	assert.Equal(t, 3, n)
+
+	stats, err := store.MemoryStats("test_domain")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Evicted)
+	assert.LessOrEqual(t, stats.Used, limit)
+
+	// The store-wide limit applies across domains
+	store.CreateDomain("other")
+	assert.NoError(t, store.ConfigureMemory("test_domain", "0", ""))
+	store.SetMaxMemory(stats.Used + stringSize("x", "value"))
+	assert.NoError(t, store.SetString("other", "x", "value"))
+	assert.Equal(t, errOutOfMemory, store.SetString("other", "y", "value"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "l", "1", "one"))
+	n, _ = store.Exists("test_domain", []string{"k0", "k3", "k4"})
+	assert.Less(t, n, 3)
+
+	assert.EqualError(t, store.ConfigureMemory("test_domain", "", "volatile-lru"), `unknown eviction policy "volatile-lru"`)
+}
+
+func TestCopyOutOfMemory(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	assert.NoError(t, store.SetString("test_domain", "src", "a longer value"))
+	assert.NoError(t, store.SetString("test_domain", "dst", "short"))
+	stats, err := store.MemoryStats("test_domain")
+	assert.NoError(t, err)
+	assert.NoError(t, store.ConfigureMemory("test_domain", strconv.FormatInt(stats.Used, 10), string(NoEviction)))
+
+	// A replacing copy that does not fit leaves the destination alone
+	_, err = store.Copy("test_domain", "src", "dst", true)
+	assert.Equal(t, errOutOfMemory, err)
+	value, err := store.GetString("test_domain", "dst")
+	assert.NoError(t, err)
+	assert.Equal(t, "short", value)
+
+	// One that fits once the destination is freed goes through
+	_, err = store.Copy("test_domain", "dst", "src", true)
+	assert.NoError(t, err)
+	value, _ = store.GetString("test_domain", "src")
+	assert.Equal(t, "short", value)
+}
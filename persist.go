@@ -0,0 +1,90 @@
+package kvs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// snapshotExt is the extension of the per-domain files written by
+// SaveSnapshot.
+const snapshotExt = ".jsonl"
+
+// SaveSnapshot writes every domain to its own file in dir, in the format of
+// ExportDomain. Each file is written to a temporary name first and renamed
+// into place, so a crash never leaves a domain half written. Only data is
+// saved; limits and memory settings come from configuration.
+func (s *Store) SaveSnapshot(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	domains := make(map[string]*Domain, len(s.domains))
+	for name, d := range s.domains {
+		domains[name] = d
+	}
+	s.mu.RUnlock()
+
+	for name, d := range domains {
+		path := filepath.Join(dir, url.PathEscape(name)+snapshotExt)
+		if err := saveDomain(d, path); err != nil {
+			return fmt.Errorf("saving domain %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func saveDomain(d *Domain, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := d.export(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshot restores the domains saved in dir by SaveSnapshot, replacing
+// the data of domains that already exist. A missing dir is not an error.
+func (s *Store) LoadSnapshot(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, snapshotExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(file, snapshotExt))
+		if err != nil {
+			return fmt.Errorf("snapshot file %q: %v", file, err)
+		}
+		f, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		_, err = s.ensureDomain(name).importRecords(f, ImportOverwrite)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("loading domain %q: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package kvs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore()
+	store.CreateDomain("a/b")
+	assert.NoError(t, store.SetString("a/b", "k", "v"))
+	assert.NoError(t, store.InsertToSkipList("a/b", "l", "1", "one"))
+	store.CreateDomain("empty")
+	assert.NoError(t, store.SaveSnapshot(dir))
+
+	restored := NewStore()
+	assert.NoError(t, restored.CreateDomainWithLimits("a/b", Limits{MaxKeys: 5}))
+	assert.NoError(t, restored.SetString("a/b", "stale", "x"))
+	assert.NoError(t, restored.LoadSnapshot(dir))
+	value, _ := restored.GetString("a/b", "k")
+	assert.Equal(t, "v", value)
+	value, _ = restored.SearchInSkipList("a/b", "l", "1")
+	assert.Equal(t, "one", value)
+	exists, _ := restored.Exists("a/b", []string{"stale"})
+	assert.Equal(t, 0, exists)
+	limits, _ := restored.Limits("a/b")
+	assert.Equal(t, 5, limits.MaxKeys)
+	_, err := restored.Type("empty", "k")
+	assert.NoError(t, err)
+
+	assert.NoError(t, NewStore().LoadSnapshot(dir+"/missing"))
+}
@@ -0,0 +1,113 @@
+package kvs
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate events per second on average, with bursts of up
+// to burst events.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket. A burst below 1 is raised to the
+// rate rounded up, so a bucket always admits at least one event.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// allow takes a token if one is available. Otherwise it reports how long
+// until the next token.
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RateLimitError is returned for a request over a rate limit. Scope names
+// the limit: "connection", "user" or "domain".
+type RateLimitError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Scope + " " + errRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == errRateLimited
+}
+
+// take takes a token from b, if b is not nil, or returns a RateLimitError
+// for scope.
+func (b *tokenBucket) take(scope string) error {
+	if b == nil {
+		return nil
+	}
+	if ok, retryAfter := b.allow(); !ok {
+		return &RateLimitError{Scope: scope, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// WithConnectionRateLimit limits every websocket connection to rate
+// requests per second, allowing bursts of up to burst requests.
+func WithConnectionRateLimit(rate float64, burst int) ServerOption {
+	return func(s *Server) {
+		s.connRate = rate
+		s.connBurst = burst
+	}
+}
+
+// WithUserRateLimit limits every authenticated user to rate requests per
+// second over all its connections and the export and import endpoints,
+// allowing bursts of up to burst requests.
+func WithUserRateLimit(rate float64, burst int) ServerOption {
+	return func(s *Server) {
+		s.userRate = rate
+		s.userBurst = burst
+	}
+}
+
+// connLimiter returns a limiter for a new connection, or nil if there is
+// no connection rate limit.
+func (s *Server) connLimiter() *tokenBucket {
+	if s.connRate <= 0 {
+		return nil
+	}
+	return newTokenBucket(s.connRate, s.connBurst)
+}
+
+// userLimiter returns the limiter shared by the requests of user, or nil
+// if there is no user rate limit.
+func (s *Server) userLimiter(user string) *tokenBucket {
+	if s.userRate <= 0 || user == "" {
+		return nil
+	}
+	s.userLimitersMu.Lock()
+	defer s.userLimitersMu.Unlock()
+	limiter, ok := s.userLimiters[user]
+	if !ok {
+		limiter = newTokenBucket(s.userRate, s.userBurst)
+		s.userLimiters[user] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,82 @@
+package kvs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimits(t *testing.T) {
+	store := NewStore()
+	assert.NoError(t, store.CreateDomainWithLimits("slow", Limits{RequestsPerSecond: 1, Burst: 1}))
+	store.CreateDomain("fast")
+	server, err := StartServer("ws://127.0.0.1:0/kvs",
+		WithStore(store),
+		WithAuthTokens(map[string]string{"alice-token": "alice", "bob-token": "bob"}),
+		WithConnectionRateLimit(1, 3),
+		WithUserRateLimit(1, 4))
+	assert.NoError(t, err)
+	defer server.CloseServer()
+	url := "ws://" + server.Addr().String() + "/kvs"
+	dial := func(token string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+		assert.NoError(t, err)
+		return conn
+	}
+	send := func(conn *websocket.Conn, req Request) Response {
+		assert.NoError(t, conn.WriteJSON(req))
+		var resp Response
+		assert.NoError(t, conn.ReadJSON(&resp))
+		return resp
+	}
+
+	// Each domain has its own limit
+	bob := dial("bob-token")
+	defer bob.Close()
+	assert.Equal(t, "success", send(bob, Request{Action: "set_string", Domain: "slow", Key: "k", Value: "v"}).Status)
+	resp := send(bob, Request{Action: "get_string", Domain: "slow", Key: "k"})
+	assert.Equal(t, "rate_limited", resp.Status)
+	assert.Equal(t, "domain request rate limit exceeded", resp.Message)
+	assert.Greater(t, resp.RetryAfterMs, int64(0))
+	assert.Equal(t, "success", send(bob, Request{Action: "set_string", Domain: "fast", Key: "k", Value: "v"}).Status)
+
+	// Then the connection runs out
+	resp = send(bob, Request{Action: "get_string", Domain: "fast", Key: "k"})
+	assert.Equal(t, "rate_limited", resp.Status)
+	assert.Equal(t, "connection request rate limit exceeded", resp.Message)
+	assert.InDelta(t, 1000, resp.RetryAfterMs, 100)
+
+	// A user shares its limit between its connections and the HTTP endpoints
+	first, second := dial("alice-token"), dial("alice-token")
+	defer first.Close()
+	defer second.Close()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "success", send(first, Request{Action: "get_string", Domain: "fast", Key: "k"}).Status)
+	}
+	assert.Equal(t, "success", send(second, Request{Action: "get_string", Domain: "fast", Key: "k"}).Status)
+	resp = send(second, Request{Action: "get_string", Domain: "fast", Key: "k"})
+	assert.Equal(t, "rate_limited", resp.Status)
+	assert.Equal(t, "user request rate limit exceeded", resp.Message)
+
+	// Requests refused for want of authentication use up nothing, and the
+	// user's limit applies from the first request after auth
+	anon, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer anon.Close()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "authentication required", send(anon, Request{Action: "get_string", Domain: "fast", Key: "k"}).Message)
+	}
+	assert.Equal(t, "success", send(anon, Request{Action: "auth", Token: "alice-token"}).Status)
+	resp = send(anon, Request{Action: "get_string", Domain: "fast", Key: "k"})
+	assert.Equal(t, "user request rate limit exceeded", resp.Message)
+
+	req, _ := http.NewRequest("GET", "http://"+server.Addr().String()+"/kvs/export?domain=fast", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+}
@@ -0,0 +1,265 @@
+package kvs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultScanCount is the number of keys a scan examines per call when the
+// request gives no count.
+const defaultScanCount = 10
+
+// Scan walks the keys of a domain in lexicographic order, a page at a time.
+// It examines up to count keys after cursor ("0" or "" to start) and returns
+// those matching the glob pattern match and type typ ("string", "skiplist"
+// or "" for both), along with the cursor of the next page, "0" once the walk
+// is complete. Because the cursor is the last key examined, keys added or
+// removed during a walk never cause other keys to be skipped or repeated.
+func (s *Store) Scan(domain, cursor, match, typ, count string) ([]string, string, error) {
+	after, started, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	n := defaultScanCount
+	if count != "" {
+		if n, err = strconv.Atoi(count); err != nil || n < 1 {
+			return nil, "", fmt.Errorf("count must be a positive integer")
+		}
+	}
+	if typ != "" && typ != "string" && typ != "skiplist" {
+		return nil, "", fmt.Errorf("type must be string or skiplist")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if match != "" {
+		if err := checkPattern(match); err != nil {
+			return nil, "", err
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	// Merge the two key indexes from the cursor on; a name that holds
+	// both a string and a skip list is examined once.
+	strs, lists := d.stringKeys.after(after, started), d.skipListKeys.after(after, started)
+	var keys []string
+	var last string
+	for examined := 0; examined < n && (strs != nil || lists != nil); examined++ {
+		var key string
+		isString, isSkipList := false, false
+		if lists == nil || (strs != nil && strs.key <= lists.key) {
+			key, isString = strs.key, true
+			strs = strs.next[0]
+		}
+		if lists != nil && (!isString || lists.key == key) {
+			key, isSkipList = lists.key, true
+			lists = lists.next[0]
+		}
+		last = key
+
+		if (typ == "string" && !isString) || (typ == "skiplist" && !isSkipList) {
+			continue
+		}
+		if match != "" {
+			if ok, _ := globMatch(match, key); !ok {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	next := "0"
+	if strs != nil || lists != nil {
+		next = encodeCursor(last)
+	}
+	return keys, next, nil
+}
+
+// ScanPrefix returns, in order, up to count string keys starting with
+// prefix that come after cursor, together with their values. The returned
+// cursor continues the scan and is "0" once no keys are left.
+func (s *Store) ScanPrefix(domain, prefix, cursor, count string) ([]string, []string, string, error) {
+	return s.scanStrings(domain, prefix, cursor, count, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// ScanRange is like ScanPrefix for the string keys between minKey and
+// maxKey inclusive, in byte-wise lexicographic order. An empty maxKey leaves
+// the range unbounded above.
+func (s *Store) ScanRange(domain, minKey, maxKey, cursor, count string) ([]string, []string, string, error) {
+	return s.scanStrings(domain, minKey, cursor, count, func(key string) bool {
+		return maxKey == "" || key <= maxKey
+	})
+}
+
+// scanStrings reads string keys in order from the first key at or after
+// from, resuming after cursor, for as long as in reports they are in range.
+func (s *Store) scanStrings(domain, from, cursor, count string, in func(string) bool) ([]string, []string, string, error) {
+	after, started, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	n := defaultScanCount
+	if count != "" {
+		if n, err = strconv.Atoi(count); err != nil || n < 1 {
+			return nil, nil, "", fmt.Errorf("count must be a positive integer")
+		}
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	x := d.stringKeys.seek(from)
+	if started && after >= from {
+		x = d.stringKeys.seek(after)
+		if x != nil && x.key == after {
+			x = x.next[0]
+		}
+	}
+
+	var keys, values []string
+	for ; x != nil && in(x.key) && len(keys) < n; x = x.next[0] {
+		keys = append(keys, x.key)
+		values = append(values, d.stringStore[x.key])
+	}
+	next := "0"
+	if x != nil && in(x.key) {
+		next = encodeCursor(keys[len(keys)-1])
+	}
+	return keys, values, next, nil
+}
+
+// cursorPrefix starts every cursor that points after a key, so that even
+// the cursor after the empty key is neither empty nor "0".
+const cursorPrefix = "c"
+
+// encodeCursor returns the cursor that resumes a walk after key.
+func encodeCursor(key string) string {
+	return cursorPrefix + base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor returns the key a cursor points after and whether the walk
+// has started at all.
+func decodeCursor(cursor string) (string, bool, error) {
+	if cursor == "" || cursor == "0" {
+		return "", false, nil
+	}
+	encoded, ok := strings.CutPrefix(cursor, cursorPrefix)
+	if !ok {
+		return "", false, fmt.Errorf("invalid cursor")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid cursor")
+	}
+	return string(key), true, nil
+}
+
+// globMatch reports whether name matches the glob pattern, which supports
+// '*', '?', character classes such as [abc], [^a] and [a-z], and '\' to
+// escape the next character. On a mismatch after a '*' it only retries
+// from that last '*', so matching takes O(len(pattern)*len(name)) time.
+func globMatch(pattern, name string) (bool, error) {
+	if err := checkPattern(pattern); err != nil {
+		return false, err
+	}
+	p, n := 0, 0
+	star, starN := -1, 0
+	for n < len(name) {
+		if p < len(pattern) {
+			width, ok := 1, false
+			switch pattern[p] {
+			case '*':
+				star, starN = p, n
+				p++
+				continue
+			case '?':
+				ok = true
+			case '[':
+				width, ok, _ = matchClass(pattern[p:], name[n:])
+			case '\\':
+				width, ok = 2, pattern[p+1] == name[n]
+			default:
+				ok = pattern[p] == name[n]
+			}
+			if ok {
+				p += width
+				n++
+				continue
+			}
+		}
+		if star < 0 {
+			return false, nil
+		}
+		// Let the last '*' take one more byte and retry from there
+		starN++
+		p, n = star+1, starN
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern), nil
+}
+
+// checkPattern reports malformed glob patterns.
+func checkPattern(pattern string) error {
+	for p := 0; p < len(pattern); p++ {
+		switch pattern[p] {
+		case '[':
+			width, _, err := matchClass(pattern[p:], "")
+			if err != nil {
+				return err
+			}
+			p += width - 1
+		case '\\':
+			if p+1 == len(pattern) {
+				return fmt.Errorf("invalid pattern: trailing backslash")
+			}
+			p++
+		}
+	}
+	return nil
+}
+
+// matchClass matches the first byte of name against the character class at
+// the start of pattern and returns the length of the class.
+func matchClass(pattern, name string) (int, bool, error) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return 0, false, fmt.Errorf("invalid pattern: unterminated character class")
+		}
+		if pattern[i] == ']' && !first {
+			i++
+			break
+		}
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		lo, hi := pattern[i], pattern[i]
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		if len(name) > 0 && lo <= name[0] && name[0] <= hi {
+			matched = true
+		}
+		i++
+	}
+	return i, len(name) > 0 && matched != negate, nil
+}
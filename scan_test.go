@@ -0,0 +1,174 @@
+package kvs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScan(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, store.SetString("test_domain", fmt.Sprintf("user:%02d", i), "value"))
+	}
+	assert.NoError(t, store.InsertToSkipList("test_domain", "board", "1", "one"))
+	assert.NoError(t, store.InsertToSkipList("test_domain", "user:05", "1", "one"))
+
+	// Walk everything, adding a key behind the cursor half way through
+	var all []string
+	cursor := "0"
+	for pages := 0; ; pages++ {
+		keys, next, err := store.Scan("test_domain", cursor, "", "", "10")
+		assert.NoError(t, err)
+		all = append(all, keys...)
+		if pages == 1 {
+			assert.NoError(t, store.SetString("test_domain", "a", "value"))
+		}
+		if next == "0" {
+			break
+		}
+		cursor = next
+	}
+	assert.Len(t, all, 26)
+	assert.Equal(t, "board", all[0])
+	assert.Equal(t, "user:24", all[25])
+
+	keys, next, err := store.Scan("test_domain", "0", "user:1?", "", "100")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", next)
+	assert.Len(t, keys, 10)
+
+	keys, _, err = store.Scan("test_domain", "0", "", "skiplist", "100")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"board", "user:05"}, keys)
+
+	_, _, err = store.Scan("test_domain", "0", "", "list", "")
+	assert.EqualError(t, err, "type must be string or skiplist")
+	_, _, err = store.Scan("test_domain", "!", "", "", "")
+	assert.EqualError(t, err, "invalid cursor")
+
+	// A page ending on the empty key still has a cursor to continue from
+	store.CreateDomain("empty_key")
+	assert.NoError(t, store.SetString("empty_key", "", "value"))
+	assert.NoError(t, store.SetString("empty_key", "a", "value"))
+	keys, next, err = store.Scan("empty_key", "0", "", "", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keys)
+	assert.NotEmpty(t, next)
+	assert.NotEqual(t, "0", next)
+	keys, next, err = store.Scan("empty_key", next, "", "", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, keys)
+	assert.Equal(t, "0", next)
+
+	// The action returns keys in Keys, like scan_prefix and scan_range
+	resp := store.handleRequest(Request{Action: "scan", Domain: "test_domain", Match: "board", Count: "100"})
+	assert.Equal(t, []string{"board"}, resp.Keys)
+	assert.Empty(t, resp.Values)
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:42", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"*:*:name", "user:42:name", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbxcx", false},
+		{"*[0-9]", "key7", true},
+		{"*\\?", "what?", true},
+	}
+	for _, test := range tests {
+		matched, err := globMatch(test.pattern, test.name)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, matched, "globMatch(%q, %q)", test.pattern, test.name)
+	}
+
+	_, err := globMatch("h[ae", "hello")
+	assert.Error(t, err)
+	_, err = globMatch("user\\", "")
+	assert.Error(t, err)
+
+	// Patterns with many stars must not backtrack exponentially
+	start := time.Now()
+	matched, err := globMatch(strings.Repeat("a*", 40)+"b", strings.Repeat("a", 100))
+	assert.NoError(t, err)
+	assert.False(t, matched)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestScanPrefixAndRange(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+	for i := 0; i < 12; i++ {
+		assert.NoError(t, store.SetString("test_domain", fmt.Sprintf("user:42:%02d", i), strconv.Itoa(i)))
+	}
+	assert.NoError(t, store.SetString("test_domain", "user:41", "before"))
+	assert.NoError(t, store.SetString("test_domain", "user:43", "after"))
+	_, err := store.GetDel("test_domain", "user:42:03")
+	assert.NoError(t, err)
+
+	var keys, values []string
+	cursor := "0"
+	for {
+		k, v, next, err := store.ScanPrefix("test_domain", "user:42:", cursor, "5")
+		assert.NoError(t, err)
+		keys = append(keys, k...)
+		values = append(values, v...)
+		if next == "0" {
+			break
+		}
+		cursor = next
+	}
+	assert.Len(t, keys, 11)
+	assert.Equal(t, "user:42:00", keys[0])
+	assert.Equal(t, "user:42:04", keys[3])
+	assert.Equal(t, "11", values[10])
+
+	keys, values, next, err := store.ScanRange("test_domain", "user:41", "user:42:01", "0", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:41", "user:42:00", "user:42:01"}, keys)
+	assert.Equal(t, []string{"before", "0", "1"}, values)
+	assert.Equal(t, "0", next)
+
+	keys, _, next, err = store.ScanRange("test_domain", "user:42:10", "", "0", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:42:10", "user:42:11"}, keys)
+	keys, _, next, err = store.ScanRange("test_domain", "user:42:10", "", next, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:43"}, keys)
+	assert.Equal(t, "0", next)
+
+	// Walks that pass the empty key move on from it
+	assert.NoError(t, store.SetString("test_domain", "", "empty"))
+	keys, _, next, err = store.ScanPrefix("test_domain", "", "0", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keys)
+	keys, _, _, err = store.ScanPrefix("test_domain", "", next, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:41"}, keys)
+	keys, _, next, err = store.ScanRange("test_domain", "", "user:41", "0", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keys)
+	keys, _, next, err = store.ScanRange("test_domain", "", "user:41", next, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:41"}, keys)
+	assert.Equal(t, "0", next)
+}
@@ -0,0 +1,399 @@
+package kvs
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdownTimeout bounds how long CloseServer waits for connections to
+// drain.
+const shutdownTimeout = 5 * time.Second
+
+// Server serves a Store over websocket at the path of its URL, with domain
+// export and import over HTTP at <path>/export and <path>/import. A Server
+// is an http.Handler, so it can also be mounted on another server instead
+// of being started.
+type Server struct {
+	httpServer *http.Server
+	mux        *http.ServeMux
+	store      *Store
+	url        *url.URL
+	listener   net.Listener
+	serveErr   chan error
+	closeOnce  sync.Once
+	closeErr   error
+
+	// conns are the live websocket connections. Once closing is set no
+	// new ones are accepted and live ones stop after their current request.
+	conns   map[*websocket.Conn]struct{}
+	connsMu sync.Mutex
+	connsWG sync.WaitGroup
+	closing atomic.Bool
+
+	// Limits of the websocket connections, see conn.go. connCount and
+	// connsPerIP count the admitted connections, under connsMu.
+	upgrader       websocket.Upgrader
+	allowedOrigins []string
+	maxMessageSize int64
+	maxConns       int
+	maxConnsPerIP  int
+	idleTimeout    time.Duration
+	connCount      int
+	connsPerIP     map[string]int
+
+	certFile          string
+	keyFile           string
+	caFile            string
+	requireClientCert bool
+	certs             *certReloader
+
+	tokens tokenSet
+	acl    *ACL
+
+	// Request rate limits, see ratelimit.go.
+	connRate       float64
+	connBurst      int
+	userRate       float64
+	userBurst      int
+	userLimiters   map[string]*tokenBucket
+	userLimitersMu sync.Mutex
+
+	snapshotDir      string
+	snapshotInterval time.Duration
+	stopSnapshots    chan struct{}
+	snapshotsDone    chan struct{}
+}
+
+// A ServerOption configures a Server created by NewServer or StartServer.
+type ServerOption func(*Server)
+
+// WithStore makes the server serve store instead of a new, empty Store.
+func WithStore(store *Store) ServerOption {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithListener makes the server accept connections on l instead of
+// listening on the host of its URL.
+func WithListener(l net.Listener) ServerOption {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// WithTLS makes the server accept wss:// connections using the given PEM
+// certificate and key files.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(s *Server) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// WithClientCA makes a TLS server verify client certificates against the
+// PEM CA certificates in caFile. With require set, clients without a valid
+// certificate are refused; otherwise a certificate is optional but checked
+// when given. See ClientIdentity for the identity a certificate maps to.
+func WithClientCA(caFile string, require bool) ServerOption {
+	return func(s *Server) {
+		s.caFile = caFile
+		s.requireClientCert = require
+	}
+}
+
+// WithPersistence loads the store from the snapshot in dir on start, saves
+// it there every interval and once more when the server is closed. An
+// interval of 0 only saves on close.
+func WithPersistence(dir string, interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.snapshotDir = dir
+		s.snapshotInterval = interval
+	}
+}
+
+// NewServer creates a server for urlStr, a ws:// or wss:// URL, without
+// starting it.
+func NewServer(urlStr string, opts ...ServerOption) (*Server, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	s := &Server{
+		store:          NewStore(),
+		url:            u,
+		mux:            http.NewServeMux(),
+		conns:          make(map[*websocket.Conn]struct{}),
+		connsPerIP:     make(map[string]int),
+		userLimiters:   make(map[string]*tokenBucket),
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.upgrader.CheckOrigin = s.checkOrigin
+	if u.Scheme == "wss" && s.certFile == "" {
+		return nil, fmt.Errorf("wss requires a certificate and key")
+	}
+	if s.caFile != "" && s.certFile == "" {
+		return nil, fmt.Errorf("client certificates require a server certificate and key")
+	}
+
+	s.mux.HandleFunc(u.Path, s.handleWebSocket)
+	s.mux.HandleFunc(path.Join(u.Path, "export"), s.allowOrigin(s.requireAuth("export_domain", s.store.HandleExport)))
+	s.mux.HandleFunc(path.Join(u.Path, "import"), s.allowOrigin(s.requireAuth("import_domain", s.store.importHandler(s.maxMessageSize))))
+	return s, nil
+}
+
+// StartServer creates a server with NewServer and starts it.
+func StartServer(urlStr string, opts ...ServerOption) (*Server, error) {
+	s, err := NewServer(urlStr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeHTTP routes requests to the websocket, export and import handlers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start loads the persisted snapshot, if any, binds the listener and serves
+// in the background. Errors up to the point the server accepts connections
+// are returned; later ones are returned by CloseServer.
+func (s *Server) Start() error {
+	if s.snapshotDir != "" {
+		if err := s.store.LoadSnapshot(s.snapshotDir); err != nil {
+			return err
+		}
+	}
+
+	if s.listener == nil {
+		l, err := net.Listen("tcp", s.url.Host)
+		if err != nil {
+			return err
+		}
+		s.listener = l
+	}
+	l := s.listener
+	if s.certFile != "" {
+		clientAuth := tls.VerifyClientCertIfGiven
+		if s.requireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+		certs, err := newCertReloader(s.certFile, s.keyFile, s.caFile, clientAuth)
+		if err != nil {
+			s.listener.Close()
+			return err
+		}
+		s.certs = certs
+		l = tls.NewListener(l, &tls.Config{GetConfigForClient: certs.getConfigForClient})
+	}
+
+	s.httpServer = &http.Server{Handler: s.mux}
+	s.serveErr = make(chan error, 1)
+	go func() {
+		err := s.httpServer.Serve(l)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		s.serveErr <- err
+	}()
+
+	if s.snapshotDir != "" && s.snapshotInterval > 0 {
+		s.stopSnapshots = make(chan struct{})
+		s.snapshotsDone = make(chan struct{})
+		go s.saveSnapshots()
+	}
+	return nil
+}
+
+// handleWebSocket is Store.HandleWebSocket with the connection limits,
+// authentication and the connection tracked for Shutdown. Invalid
+// credentials on the upgrade request are refused outright; a client without
+// any may still send an auth action.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r)
+	if err := s.admit(ip); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.release(ip)
+
+	c := &session{server: s, limiter: s.connLimiter()}
+	if s.authRequired() {
+		user, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		c.user = user
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(s.maxMessageSize)
+	if !s.track(conn) {
+		goingAway(conn)
+		return
+	}
+	defer s.untrack(conn)
+
+	serveConn(conn, &s.closing, s.idleTimeout, c.handle)
+	if s.closing.Load() {
+		goingAway(conn)
+	}
+}
+
+func (s *Server) track(conn *websocket.Conn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.closing.Load() {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.connsWG.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn *websocket.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, conn)
+	s.connsWG.Done()
+}
+
+// goingAway tells the client the server is shutting down.
+func goingAway(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// ReloadTLS reads the certificate, key and client CA files again, for
+// example on SIGHUP. New connections use them; established ones are not
+// affected. Changed files are also picked up on their own within a few
+// seconds. On error the current certificates stay in use.
+func (s *Server) ReloadTLS() error {
+	if s.certs == nil {
+		return fmt.Errorf("server does not use TLS")
+	}
+	return s.certs.reload()
+}
+
+// Addr returns the address the server listens on, which tells the port
+// picked for a URL or listener with port 0. It is nil before Start.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// saveSnapshots saves the store every snapshotInterval until stopSnapshots
+// is closed.
+func (s *Server) saveSnapshots() {
+	defer close(s.snapshotsDone)
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.store.SaveSnapshot(s.snapshotDir); err != nil {
+				log.Printf("snapshot: %v", err)
+			}
+		case <-s.stopSnapshots:
+			return
+		}
+	}
+}
+
+// drain stops the websocket connections and waits for them to finish.
+func (s *Server) drain(ctx context.Context) error {
+	s.connsMu.Lock()
+	s.closing.Store(true)
+	for conn := range s.conns {
+		// Interrupt the read the connection is blocked in; a request
+		// being handled is still answered.
+		conn.SetReadDeadline(time.Now())
+	}
+	s.connsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.connsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.connsMu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.connsMu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Store returns the Store the server serves.
+func (s *Server) Store() *Store {
+	return s.store
+}
+
+// CloseServer is Shutdown with a timeout of five seconds.
+func (s *Server) CloseServer() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// Shutdown stops a started server: it stops accepting connections, lets
+// every websocket client finish the request it is being served, sends it a
+// going away close frame and, once all connections are gone, saves the
+// final snapshot. Connections still open when ctx is done are closed
+// abruptly. Shutdown returns any error the server stopped with; later calls
+// return the same error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpServer == nil {
+		return fmt.Errorf("server not started")
+	}
+	s.closeOnce.Do(func() {
+		err := s.httpServer.Shutdown(ctx)
+		err = errors.Join(err, <-s.serveErr, s.drain(ctx))
+		if s.stopSnapshots != nil {
+			close(s.stopSnapshots)
+			<-s.snapshotsDone
+		}
+		if s.snapshotDir != "" {
+			err = errors.Join(err, s.store.SaveSnapshot(s.snapshotDir))
+		}
+		s.closeErr = err
+	})
+	return s.closeErr
+}
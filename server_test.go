@@ -0,0 +1,95 @@
+package kvs
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("shared")
+
+	// Two servers on the same store, one listening by URL and one on a
+	// listener we own, both on ports picked by the system.
+	first, err := StartServer("ws://127.0.0.1:0/kvs", WithStore(store))
+	assert.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	second, err := StartServer("ws://unused/kvs", WithStore(store), WithListener(l))
+	assert.NoError(t, err)
+	assert.Equal(t, l.Addr(), second.Addr())
+	assert.Same(t, store, second.Store())
+
+	send := func(s *Server, req Request) Response {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+s.Addr().String()+"/kvs", nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+		assert.NoError(t, conn.WriteJSON(req))
+		var resp Response
+		assert.NoError(t, conn.ReadJSON(&resp))
+		return resp
+	}
+	assert.Equal(t, "success", send(first, Request{Action: "set_string", Domain: "shared", Key: "k", Value: "v"}).Status)
+	assert.Equal(t, "v", send(second, Request{Action: "get_string", Domain: "shared", Key: "k"}).Value)
+
+	// The export endpoint is served next to the websocket path
+	res, err := http.Get("http://" + first.Addr().String() + "/kvs/export?domain=shared")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Startup errors come back to the caller
+	_, err = StartServer("ws://" + first.Addr().String() + "/kvs")
+	assert.Error(t, err)
+	_, err = StartServer("wss://127.0.0.1:0/kvs")
+	assert.EqualError(t, err, "wss requires a certificate and key")
+
+	assert.NoError(t, first.CloseServer())
+	assert.NoError(t, first.CloseServer())
+	assert.NoError(t, second.CloseServer())
+
+	// A server that is not started is still a handler
+	handler, err := NewServer("ws://unused/kvs", WithStore(store))
+	assert.NoError(t, err)
+	assert.Nil(t, handler.Addr())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[len("http"):]+"/kvs", nil)
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	dir := t.TempDir()
+	server, err := StartServer("ws://127.0.0.1:0/kvs", WithPersistence(dir, 0))
+	assert.NoError(t, err)
+	server.Store().CreateDomain("test_domain")
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr().String()+"/kvs", nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, conn.WriteJSON(Request{Action: "set_string", Domain: "test_domain", Key: "k", Value: "v"}))
+	var resp Response
+	assert.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, "success", resp.Status)
+
+	// The idle client is told the server is going away
+	closed := make(chan error, 1)
+	go func() { closed <- server.CloseServer() }()
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+	assert.NoError(t, <-closed)
+
+	// No new connections are accepted and the data was flushed
+	_, _, err = websocket.DefaultDialer.Dial("ws://"+server.Addr().String()+"/kvs", nil)
+	assert.Error(t, err)
+	restored := NewStore()
+	assert.NoError(t, restored.LoadSnapshot(dir))
+	value, _ := restored.GetString("test_domain", "k")
+	assert.Equal(t, "v", value)
+}
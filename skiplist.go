@@ -165,6 +165,7 @@ package kvs
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 )
 
 const MaxLevel int = 16
@@ -178,9 +179,19 @@ type Node struct {
 	span    []int
 }
 
+// SkipList methods do not lock; mu is held by callers that share a list
+// between goroutines, such as Store.
 type SkipList struct {
-	header *Node
-	level  int
+	header   *Node
+	level    int
+	length   int
+	bytes    int
+	maxLevel int
+	p        float32
+	rand     *rand.Rand
+	mu       sync.RWMutex
+	// dropped is set under mu once a Domain no longer stores the list.
+	dropped bool
 }
 
 func NewNode(level int, key int, value string) *Node {
@@ -192,11 +203,96 @@ func NewNode(level int, key int, value string) *Node {
 	}
 }
 
-func NewSkipList() *SkipList {
-	return &SkipList{
-		header: NewNode(MaxLevel, -1, ""),
-		level:  1,
+// A SkipListOption configures a SkipList created by NewSkipList.
+type SkipListOption func(*SkipList)
+
+// WithRand makes the list draw node levels from r instead of the global
+// math/rand source, so a seeded r reproduces the exact same structure.
+func WithRand(r *rand.Rand) SkipListOption {
+	return func(sl *SkipList) {
+		sl.rand = r
+	}
+}
+
+// WithMaxLevel sets the number of levels a list may grow to. A list keeps
+// O(log n) operations up to roughly (1/p)^maxLevel elements, so raise it
+// for lists much larger than the default 2^16. It panics if maxLevel is
+// below 1; SkipListConfig validates user input instead.
+func WithMaxLevel(maxLevel int) SkipListOption {
+	if maxLevel < 1 {
+		panic("kvs: max level must be at least 1")
+	}
+	return func(sl *SkipList) {
+		sl.maxLevel = maxLevel
+	}
+}
+
+// WithP sets the probability that a node is promoted to the next level. It
+// panics unless p is in (0, 1).
+func WithP(p float32) SkipListOption {
+	if p <= 0 || p >= 1 {
+		panic("kvs: promotion probability must be in (0, 1)")
+	}
+	return func(sl *SkipList) {
+		sl.p = p
+	}
+}
+
+// maxSkipListLevel bounds SkipListConfig.MaxLevel; every list allocates a
+// header of that many levels.
+const maxSkipListLevel = 64
+
+// SkipListConfig holds the parameters of the skip lists of a Domain. Zero
+// fields keep the defaults, MaxLevel and P.
+type SkipListConfig struct {
+	MaxLevel int     `json:"max_level,omitempty" yaml:"max_level,omitempty"`
+	P        float32 `json:"p,omitempty" yaml:"p,omitempty"`
+}
+
+func (c SkipListConfig) validate() error {
+	if c.MaxLevel < 0 || c.MaxLevel > maxSkipListLevel {
+		return fmt.Errorf("max level must be between 1 and %d", maxSkipListLevel)
+	}
+	if c.P < 0 || c.P >= 1 {
+		return fmt.Errorf("promotion probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// options returns the SkipListOptions of a validated config.
+func (c SkipListConfig) options() []SkipListOption {
+	var opts []SkipListOption
+	if c.MaxLevel > 0 {
+		opts = append(opts, WithMaxLevel(c.MaxLevel))
+	}
+	if c.P > 0 {
+		opts = append(opts, WithP(c.P))
 	}
+	return opts
+}
+
+// MaxLevelFor returns the max level that keeps a list of n elements
+// O(log n) when nodes are promoted with probability p.
+func MaxLevelFor(n int, p float32) int {
+	level := 1
+	for capacity := 1 / float64(p); capacity < float64(n); capacity /= float64(p) {
+		level++
+	}
+	return level
+}
+
+func NewSkipList(opts ...SkipListOption) *SkipList {
+	sl := &SkipList{
+		level:    1,
+		maxLevel: MaxLevel,
+		p:        P,
+	}
+	for _, opt := range opts {
+		opt(sl)
+	}
+	sl.header = NewNode(sl.maxLevel, -1, "")
+	sl.bytes = skipListBytes + sl.header.size()
+	return sl
 }
 
 func RandomLevel() int {
@@ -207,6 +303,18 @@ func RandomLevel() int {
 	return level
 }
 
+func (sl *SkipList) randomLevel() int {
+	next := rand.Float32
+	if sl.rand != nil {
+		next = sl.rand.Float32
+	}
+	level := 1
+	for next() < sl.p && level < sl.maxLevel {
+		level++
+	}
+	return level
+}
+
 func (sl *SkipList) Search(key int) (string, bool) {
 	x := sl.header
 	for i := sl.level - 1; i >= 0; i-- {
@@ -222,8 +330,8 @@ func (sl *SkipList) Search(key int) (string, bool) {
 }
 
 func (sl *SkipList) Insert(key int, value string) {
-	update := make([]*Node, MaxLevel)
-	rank := make([]int, MaxLevel)
+	update := make([]*Node, sl.maxLevel)
+	rank := make([]int, sl.maxLevel)
 	x := sl.header
 
 	for i := sl.level - 1; i >= 0; i-- {
@@ -239,12 +347,12 @@ func (sl *SkipList) Insert(key int, value string) {
 		update[i] = x
 	}
 
-	level := RandomLevel()
+	level := sl.randomLevel()
 	if level > sl.level {
 		for i := sl.level; i < level; i++ {
 			rank[i] = 0
 			update[i] = sl.header
-			update[i].span[i] = sl.header.span[i]
+			update[i].span[i] = sl.length
 		}
 		sl.level = level
 	}
@@ -261,10 +369,12 @@ func (sl *SkipList) Insert(key int, value string) {
 	for i := level; i < sl.level; i++ {
 		update[i].span[i]++
 	}
+	sl.length++
+	sl.bytes += node.size()
 }
 
 func (sl *SkipList) Delete(key int) {
-	update := make([]*Node, MaxLevel)
+	update := make([]*Node, sl.maxLevel)
 	x := sl.header
 
 	for i := sl.level - 1; i >= 0; i-- {
@@ -276,22 +386,51 @@ func (sl *SkipList) Delete(key int) {
 
 	x = x.forward[0]
 	if x != nil && x.key == key {
-		for i := 0; i < sl.level; i++ {
-			if update[i].forward[i] != x {
-				break
-			}
+		sl.deleteNode(x, update)
+	}
+}
+
+// deleteNode unlinks x given update, the last node before x on every level.
+// update stays valid for x's successor, so runs of nodes can be removed
+// without searching again.
+func (sl *SkipList) deleteNode(x *Node, update []*Node) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].forward[i] == x {
 			update[i].span[i] += x.span[i] - 1
 			update[i].forward[i] = x.forward[i]
+		} else {
+			update[i].span[i]--
 		}
+	}
 
-		for sl.level > 1 && sl.header.forward[sl.level-1] == nil {
-			sl.level--
-		}
+	for sl.level > 1 && sl.header.forward[sl.level-1] == nil {
+		sl.level--
 	}
+	sl.length--
+	sl.bytes -= x.size()
+}
+
+// DeleteRange removes every node with startKey <= key <= endKey in a single
+// pass and returns the number of nodes removed.
+func (sl *SkipList) DeleteRange(startKey, endKey int) int {
+	removed := 0
+	sl.deleteRange(startKey, endKey, func(*Node) {
+		removed++
+	})
+	return removed
+}
+
+// DeleteRangeValues is DeleteRange returning the removed values in key order.
+func (sl *SkipList) DeleteRangeValues(startKey, endKey int) []string {
+	var values []string
+	sl.deleteRange(startKey, endKey, func(x *Node) {
+		values = append(values, x.value)
+	})
+	return values
 }
 
-func (sl *SkipList) DeleteRange(startKey, endKey int) {
-	update := make([]*Node, MaxLevel)
+func (sl *SkipList) deleteRange(startKey, endKey int, removed func(*Node)) {
+	update := make([]*Node, sl.maxLevel)
 	x := sl.header
 
 	for i := sl.level - 1; i >= 0; i-- {
@@ -304,11 +443,95 @@ func (sl *SkipList) DeleteRange(startKey, endKey int) {
 	x = x.forward[0]
 	for x != nil && x.key <= endKey {
 		next := x.forward[0]
-		sl.Delete(x.key)
+		sl.deleteNode(x, update)
+		removed(x)
+		x = next
+	}
+}
+
+// DeleteRangeByRank removes the nodes whose 0-based rank lies in
+// [start, stop] and returns the number removed. Negative ranks count from
+// the end of the list, so DeleteRangeByRank(0, -1001) keeps only the 1000
+// largest keys.
+func (sl *SkipList) DeleteRangeByRank(start, stop int) int {
+	if start < 0 {
+		start += sl.length
+	}
+	if stop < 0 {
+		stop += sl.length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= sl.length {
+		stop = sl.length - 1
+	}
+	if start > stop {
+		return 0
+	}
+
+	update := make([]*Node, sl.maxLevel)
+	traversed := 0
+	x := sl.header
+
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && traversed+x.span[i] <= start {
+			traversed += x.span[i]
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	removed := 0
+	x = x.forward[0]
+	for x != nil && start+removed <= stop {
+		next := x.forward[0]
+		sl.deleteNode(x, update)
+		removed++
 		x = next
 	}
+	return removed
+}
+
+// Clone returns a deep copy of the list with the same structure. A list
+// with its own random source gets a new source seeded from it.
+func (sl *SkipList) Clone() *SkipList {
+	clone := &SkipList{
+		level:    sl.level,
+		length:   sl.length,
+		bytes:    sl.bytes,
+		maxLevel: sl.maxLevel,
+		p:        sl.p,
+	}
+	if sl.rand != nil {
+		clone.rand = rand.New(rand.NewSource(sl.rand.Int63()))
+	}
+	clone.header = NewNode(sl.maxLevel, -1, "")
+	copy(clone.header.span, sl.header.span)
+
+	last := make([]*Node, sl.maxLevel)
+	for i := range last {
+		last[i] = clone.header
+	}
+	for x := sl.header.forward[0]; x != nil; x = x.forward[0] {
+		node := NewNode(len(x.forward), x.key, x.value)
+		copy(node.span, x.span)
+		for i := range node.forward {
+			last[i].forward[i] = node
+			last[i] = node
+		}
+	}
+	return clone
+}
+
+// Len returns the number of nodes in the list.
+func (sl *SkipList) Len() int {
+	return sl.length
 }
 
+// PrintLevels writes the keys of every level to stdout.
+//
+// Deprecated: use Describe, which returns the same information as a value.
 func (sl *SkipList) PrintLevels() {
 	for i := sl.level - 1; i >= 0; i-- {
 		fmt.Printf("Level %d: ", i+1)
@@ -0,0 +1,135 @@
+package kvs
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// SkipListInfo is a structured description of a SkipList, returned by
+// Describe and by the debug_skiplist action.
+type SkipListInfo struct {
+	Length      int         `json:"length"`
+	Level       int         `json:"level"`
+	MaxLevel    int         `json:"max_level"`
+	P           float32     `json:"p"`
+	Levels      []LevelInfo `json:"levels"`
+	MemoryBytes int         `json:"memory_bytes"`
+	// InvariantError is set by Store.DebugSkipList when Validate fails.
+	InvariantError string `json:"invariant_error,omitempty"`
+}
+
+// LevelInfo describes one level of a SkipList, level 1 being the bottom.
+// Keys and Spans are only filled in by a verbose Describe; Spans[0] is the
+// header's span and Spans[j+1] the span of Keys[j].
+type LevelInfo struct {
+	Level int   `json:"level"`
+	Nodes int   `json:"nodes"`
+	Keys  []int `json:"keys,omitempty"`
+	Spans []int `json:"spans,omitempty"`
+}
+
+const (
+	skipListBytes = int(unsafe.Sizeof(SkipList{}))
+	nodeBytes     = int(unsafe.Sizeof(Node{}))
+	pointerBytes  = int(unsafe.Sizeof((*Node)(nil)))
+	spanBytes     = int(unsafe.Sizeof(int(0)))
+)
+
+// size estimates the memory held by a node, including its value.
+func (x *Node) size() int {
+	return nodeBytes + len(x.value) + cap(x.forward)*pointerBytes + cap(x.span)*spanBytes
+}
+
+// Describe returns the shape of the list. With verbose set it also lists
+// the keys and spans of every level, which is only sensible for small lists.
+func (sl *SkipList) Describe(verbose bool) SkipListInfo {
+	info := SkipListInfo{
+		Length:      sl.length,
+		Level:       sl.level,
+		MaxLevel:    sl.maxLevel,
+		P:           sl.p,
+		Levels:      make([]LevelInfo, sl.level),
+		MemoryBytes: sl.bytes,
+	}
+
+	for i := range info.Levels {
+		info.Levels[i].Level = i + 1
+		if verbose {
+			info.Levels[i].Spans = []int{sl.header.span[i]}
+		}
+	}
+	for x := sl.header.forward[0]; x != nil; x = x.forward[0] {
+		for i := range x.forward {
+			info.Levels[i].Nodes++
+			if verbose {
+				info.Levels[i].Keys = append(info.Levels[i].Keys, x.key)
+				info.Levels[i].Spans = append(info.Levels[i].Spans, x.span[i])
+			}
+		}
+	}
+	return info
+}
+
+// Validate checks the structural invariants of the list: keys are ordered,
+// every level links exactly the nodes tall enough to be on it, spans match
+// the distance between linked nodes and the length is accurate. It returns
+// nil for a consistent list. It takes one pass over the list and memory for
+// one node per level.
+func (sl *SkipList) Validate() error {
+	if sl.level < 1 || sl.level > sl.maxLevel {
+		return fmt.Errorf("level %d outside [1, %d]", sl.level, sl.maxLevel)
+	}
+	for i := sl.level; i < sl.maxLevel; i++ {
+		if sl.header.forward[i] != nil {
+			return fmt.Errorf("header links level %d above list level %d", i+1, sl.level)
+		}
+	}
+
+	// Walking level 1 in order, last[i] is the most recent node tall
+	// enough for level i and lastRank[i] its rank: level i must link it to
+	// the next such node, with a span of the ranks between them.
+	last := make([]*Node, sl.level)
+	lastRank := make([]int, sl.level)
+	for i := range last {
+		last[i] = sl.header
+	}
+	rank := 0
+	var prev *Node
+	for x := sl.header.forward[0]; x != nil; x = x.forward[0] {
+		if prev != nil && x.key < prev.key {
+			return fmt.Errorf("key %d follows larger key %d", x.key, prev.key)
+		}
+		if len(x.forward) < 1 || len(x.forward) > sl.level || len(x.span) != len(x.forward) {
+			return fmt.Errorf("node %d has %d levels and %d spans in a list of level %d", x.key, len(x.forward), len(x.span), sl.level)
+		}
+		rank++
+		for i := range x.forward {
+			if err := checkLink(last[i], lastRank[i], i, x, rank); err != nil {
+				return err
+			}
+			last[i], lastRank[i] = x, rank
+		}
+		prev = x
+	}
+	if rank != sl.length {
+		return fmt.Errorf("length is %d but level 1 links %d nodes", sl.length, rank)
+	}
+	for i := range last {
+		if err := checkLink(last[i], lastRank[i], i, nil, sl.length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLink checks that level i links x, of rank xRank, to next, of rank
+// nextRank, or ends at x when next is nil.
+func checkLink(x *Node, xRank, i int, next *Node, nextRank int) error {
+	if x.forward[i] != next {
+		return fmt.Errorf("level %d skips or misorders nodes after rank %d", i+1, xRank)
+	}
+	if x.span[i] != nextRank-xRank {
+		return fmt.Errorf("span of rank %d on level %d is %d, want %d", xRank, i+1, x.span[i], nextRank-xRank)
+	}
+	return nil
+}
@@ -1,39 +1,83 @@
 package kvs
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	//"sync"
-
 	"github.com/gorilla/websocket"
 )
 
+// Request is one action sent by a client.
+//
+// Skip list actions treat a missing list as an empty one: search_skiplist
+// answers "key not found", rank_skiplist "0", the delete actions remove
+// nothing and debug_skiplist describes an empty list. Removing the last
+// element of a list drops it, so an emptied list behaves the same way.
+// Before lists were dropped when emptied, these actions failed with "skip
+// list not found" on a missing list.
 type Request struct {
 	Action        string      `json:"action"`
 	Domain        string      `json:"domain,omitempty"`
 	Key           string      `json:"key,omitempty"`
 	SLKey         string      `json:"slkey,omitempty"`
 	Value         string      `json:"value,omitempty"`
+	Keys          []string    `json:"keys,omitempty"`
+	Values        []string    `json:"values,omitempty"`
+	Delta         string      `json:"delta,omitempty"`
+	Min           string      `json:"min,omitempty"`
+	Max           string      `json:"max,omitempty"`
 	MinKey        string      `json:"min_key,omitempty"`
 	MaxKey        string      `json:"max_key,omitempty"`
+	Start         string      `json:"start,omitempty"`
+	Stop          string      `json:"stop,omitempty"`
+	Offset        string      `json:"offset,omitempty"`
+	NewKey        string      `json:"new_key,omitempty"`
+	Replace       bool        `json:"replace,omitempty"`
+	NewDomain     string      `json:"new_domain,omitempty"`
+	Mode          string      `json:"mode,omitempty"`
+	Cursor        string      `json:"cursor,omitempty"`
+	Match         string      `json:"match,omitempty"`
+	Prefix        string      `json:"prefix,omitempty"`
+	Type          string      `json:"type,omitempty"`
+	Count         string      `json:"count,omitempty"`
+	MaxMemory     string      `json:"max_memory,omitempty"`
+	Policy        string      `json:"policy,omitempty"`
+	Verbose       bool        `json:"verbose,omitempty"`
+	Limits        *Limits     `json:"limits,omitempty"`
+	Token         string      `json:"token,omitempty"`
+	User          string      `json:"user,omitempty"`
+	Roles         []string    `json:"roles,omitempty"`
+	Role          *Role       `json:"role,omitempty"`
 }
 
+// Response answers a Request. Status is "success", "error" or, for
+// requests over a rate limit, "rate_limited".
 type Response struct {
 	Status        string      `json:"status"`
 	Message       string      `json:"message,omitempty"`
 	Value         string      `json:"value,omitempty"`
+	Keys          []string    `json:"keys,omitempty"`
 	Values        []string    `json:"values,omitempty"`
+	Found         []bool      `json:"found,omitempty"`
+	Cursor        string      `json:"cursor,omitempty"`
+	SkipList      *SkipListInfo `json:"skiplist,omitempty"`
+	Memory        *MemoryStats `json:"memory,omitempty"`
+	Limits        *Limits     `json:"limits,omitempty"`
+	ACL           *ACLInfo    `json:"acl,omitempty"`
+	RetryAfterMs  int64       `json:"retry_after_ms,omitempty"`
 }
 
 type Store struct {
 	domains map[string]*Domain
-	//mu      sync.RWMutex
+	mu      sync.RWMutex
+	memory  memoryBudget
 }
 
 func NewStore() *Store {
@@ -43,96 +87,690 @@ func NewStore() *Store {
 }
 
 func (s *Store) CreateDomain(name string) {
-	//s.mu.Lock()
-	//defer s.mu.Unlock()
-	s.domains[name] = NewDomain()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.domains[name]; ok {
+		// Detach the old domain first, so operations still running on it
+		// stop charging the store; what they charged before is in its
+		// usage and leaves the store with it.
+		old.mu.Lock()
+		old.storeMemory.Store(nil)
+		s.memory.used.Add(-old.memory.used.Load())
+		old.mu.Unlock()
+	}
+	d := NewDomain()
+	d.storeMemory.Store(&s.memory)
+	s.domains[name] = d
 }
 
-func (s *Store) SetString(domain, key, value string) error {
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
+// ConfigureSkipLists sets the parameters of the skip lists the domain
+// creates from now on; existing lists keep theirs.
+func (s *Store) ConfigureSkipLists(domain string, config SkipListConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	d, err := s.lookupDomain(domain)
+	if err != nil {
+		return err
+	}
+	d.skipLists.Store(&config)
+	return nil
+}
+
+// ensureDomain returns the named domain, creating it if it does not exist.
+func (s *Store) ensureDomain(name string) *Domain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.domains[name]
 	if !ok {
-		return fmt.Errorf("domain not found")
+		d = NewDomain()
+		d.storeMemory.Store(&s.memory)
+		s.domains[name] = d
+	}
+	return d
+}
+
+// CloneDomain creates the domain dst as a deep copy of src, including its
+// limits and memory settings. The two domains are independent afterwards.
+func (s *Store) CloneDomain(src, dst string) error {
+	if _, err := s.lookupDomain(dst); err == nil {
+		return fmt.Errorf("domain already exists")
+	}
+	d, err := s.lookupDomain(src)
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	clone := d.clone()
+	d.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.domains[dst]; ok {
+		return fmt.Errorf("domain already exists")
+	}
+	used := clone.memory.used.Load()
+	if ok, _ := fits(&s.memory, used); !ok {
+		return errOutOfMemory
+	}
+	clone.storeMemory.Store(&s.memory)
+	s.memory.used.Add(used)
+	s.domains[dst] = clone
+	return nil
+}
+
+// lookupDomain returns the named domain.
+func (s *Store) lookupDomain(name string) (*Domain, error) {
+	s.mu.RLock()
+	d, ok := s.domains[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("domain not found")
+	}
+	return d, nil
+}
+
+// domain returns the named domain for an operation on its data, counting
+// the operation against the domain's request rate limit.
+func (s *Store) domain(name string) (*Domain, error) {
+	d, err := s.lookupDomain(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.allow(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Store) SetString(domain, key, value string) error {
+	d, err := s.domain(domain)
+	if err != nil {
+		return err
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.stringStore[key] = value
-	return nil
+	return d.setString(key, value)
 }
 
 func (s *Store) GetString(domain, key string) (string, error) {
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	value, ok := d.stringStore[key]
 	if !ok {
-		return "", fmt.Errorf("domain not found")
+		return "", fmt.Errorf("key not found")
+	}
+	d.touch(key)
+	return value, nil
+}
+
+// maxStringLength bounds the values SetRange and Append may build.
+const maxStringLength = 512 << 20
+
+// Append appends value to the string at key, creating it if missing, and
+// returns the new length.
+func (s *Store) Append(domain, key, value string) (int, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := d.stringStore[key]
+	if len(current)+len(value) > maxStringLength {
+		return 0, fmt.Errorf("string exceeds maximum allowed size")
+	}
+	if err := d.setString(key, current+value); err != nil {
+		return 0, err
+	}
+	return len(current) + len(value), nil
+}
+
+// GetRange returns the bytes of the string at key between the offsets start
+// and end, both inclusive. Negative offsets count from the end of the string
+// and a missing key reads as the empty string.
+func (s *Store) GetRange(domain, key, start, end string) (string, error) {
+	intStart, err := strconv.Atoi(start)
+	if err != nil {
+		return "", fmt.Errorf("start must be integer")
+	}
+	intEnd, err := strconv.Atoi(end)
+	if err != nil {
+		return "", fmt.Errorf("end must be integer")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	value := d.stringStore[key]
+	d.touch(key)
+	if intStart < 0 {
+		intStart += len(value)
+	}
+	if intEnd < 0 {
+		intEnd += len(value)
+	}
+	intStart = max(intStart, 0)
+	intEnd = min(intEnd, len(value)-1)
+	if intStart > intEnd {
+		return "", nil
+	}
+	return value[intStart : intEnd+1], nil
+}
+
+// SetRange overwrites the string at key starting at offset with value,
+// padding with zero bytes if the string is shorter than offset, and returns
+// the new length.
+func (s *Store) SetRange(domain, key, offset, value string) (int, error) {
+	intOffset, err := strconv.Atoi(offset)
+	if err != nil || intOffset < 0 {
+		return 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	if intOffset > maxStringLength-len(value) {
+		return 0, fmt.Errorf("string exceeds maximum allowed size")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := d.stringStore[key]
+	if len(value) == 0 {
+		return len(current), nil
+	}
+
+	buf := []byte(current)
+	if n := intOffset + len(value); n > len(buf) {
+		buf = append(buf, make([]byte, n-len(buf))...)
+	}
+	copy(buf[intOffset:], value)
+	if err := d.setString(key, string(buf)); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// StrLen returns the length of the string at key, 0 if it is missing.
+func (s *Store) StrLen(domain, key string) (int, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
 	}
 
 	d.mu.RLock()
 	defer d.mu.RUnlock()
+	d.touch(key)
+	return len(d.stringStore[key]), nil
+}
+
+// GetSet sets key to value and returns the previous value and whether there
+// was one.
+func (s *Store) GetSet(domain, key, value string) (string, bool, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, found := d.stringStore[key]
+	if err := d.setString(key, value); err != nil {
+		return "", false, err
+	}
+	return old, found, nil
+}
+
+// GetDel deletes key and returns the value it held.
+func (s *Store) GetDel(domain, key string) (string, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	value, ok := d.stringStore[key]
 	if !ok {
 		return "", fmt.Errorf("key not found")
 	}
+	d.deleteString(key)
 	return value, nil
 }
 
-func (s *Store) Increment(domain, key string) error {
-	d, ok := s.domains[domain]
-	if (!ok) {
-		return fmt.Errorf("domain not found")
+// MGet returns the values of keys along with whether each key was found.
+func (s *Store) MGet(domain string, keys []string) ([]string, []bool, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		values[i], found[i] = d.stringStore[key]
+		d.touch(key)
+	}
+	return values, found, nil
+}
+
+// MSet sets keys[i] to values[i] for every i.
+func (s *Store) MSet(domain string, keys, values []string) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("keys and values must have the same length")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return err
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	val, err := strconv.Atoi(d.stringStore[key])
-	if (err != nil) {
-		return fmt.Errorf("%s value is not an integer", d.stringStore[key])
+	if err := d.checkStrings(keys, values); err != nil {
+		return err
+	}
+	if err := d.makeRoom(msetSize(d, keys, values)); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		d.putString(key, values[i])
 	}
-	d.stringStore[key] = strconv.Itoa(val + 1)
 	return nil
 }
 
-func (s *Store) Decrement(domain, key string) error {
-	d, ok := s.domains[domain]
-	if (!ok) {
-		return fmt.Errorf("domain not found")
+// MSetNX is MSet that only sets anything if none of the keys exist. It
+// reports whether the keys were set.
+func (s *Store) MSetNX(domain string, keys, values []string) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("keys and values must have the same length")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return false, err
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	val, err := strconv.Atoi(d.stringStore[key])
-	if (err != nil) {
-		return fmt.Errorf("value is not an integer")
+	for _, key := range keys {
+		if _, ok := d.stringStore[key]; ok {
+			return false, nil
+		}
 	}
-	d.stringStore[key] = strconv.Itoa(val - 1)
-	return nil
+	if err := d.checkStrings(keys, values); err != nil {
+		return false, err
+	}
+	if err := d.makeRoom(msetSize(d, keys, values)); err != nil {
+		return false, err
+	}
+	for i, key := range keys {
+		d.putString(key, values[i])
+	}
+	return true, nil
 }
 
-func (s *Store) InsertToSkipList(domain, slkey, key, value string) error {
-	intKey, err := strconv.ParseInt(key, 10, 64)
+// msetSize returns how many bytes setting keys to values adds to d. A key
+// that already holds a string only adds the difference.
+func msetSize(d *Domain, keys, values []string) int64 {
+	var need int64
+	for i, key := range keys {
+		need += stringSize(key, values[i])
+		if old, ok := d.stringStore[key]; ok {
+			need -= stringSize(key, old)
+		}
+	}
+	return need
+}
+
+// Increment adds one to the integer stored at key and returns the result.
+func (s *Store) Increment(domain, key string) (string, error) {
+	return s.IncrBy(domain, key, "1", "", "")
+}
+
+// Decrement subtracts one from the integer stored at key and returns the
+// result.
+func (s *Store) Decrement(domain, key string) (string, error) {
+	return s.DecrBy(domain, key, "1", "", "")
+}
+
+// IncrBy adds delta to the integer stored at key and returns the result. A
+// missing key counts as 0. Non-empty minValue and maxValue clamp the result.
+func (s *Store) IncrBy(domain, key, delta, minValue, maxValue string) (string, error) {
+	intDelta, err := strconv.ParseInt(delta, 10, 64)
 	if err != nil {
-		return fmt.Errorf("key must be integer")
+		return "", fmt.Errorf("delta must be integer")
 	}
+	return s.addInt(domain, key, intDelta, minValue, maxValue)
+}
 
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
-	if !ok {
-		return fmt.Errorf("domain not found")
+// DecrBy subtracts delta from the integer stored at key, like IncrBy.
+func (s *Store) DecrBy(domain, key, delta, minValue, maxValue string) (string, error) {
+	intDelta, err := strconv.ParseInt(delta, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("delta must be integer")
+	}
+	if intDelta == math.MinInt64 {
+		return "", fmt.Errorf("increment or decrement would overflow")
+	}
+	return s.addInt(domain, key, -intDelta, minValue, maxValue)
+}
+
+func (s *Store) addInt(domain, key string, delta int64, minValue, maxValue string) (string, error) {
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	var err error
+	if minValue != "" {
+		if lo, err = strconv.ParseInt(minValue, 10, 64); err != nil {
+			return "", fmt.Errorf("min must be integer")
+		}
+	}
+	if maxValue != "" {
+		if hi, err = strconv.ParseInt(maxValue, 10, 64); err != nil {
+			return "", fmt.Errorf("max must be integer")
+		}
+	}
+	if lo > hi {
+		return "", fmt.Errorf("min must not be greater than max")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	sl, ok := d.skipListStore[slkey]
-	if !ok {
-		sl = NewSkipList()
-		d.skipListStore[slkey] = sl
+	var val int64
+	if str, ok := d.stringStore[key]; ok {
+		if val, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return "", fmt.Errorf("value is not an integer")
+		}
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return "", fmt.Errorf("increment or decrement would overflow")
+	}
+	val = min(max(val+delta, lo), hi)
+
+	result := strconv.FormatInt(val, 10)
+	if err := d.setString(key, result); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// IncrByFloat adds the floating point delta to the number stored at key and
+// returns the result. A missing key counts as 0. Non-empty minValue and
+// maxValue clamp the result.
+func (s *Store) IncrByFloat(domain, key, delta, minValue, maxValue string) (string, error) {
+	floatDelta, err := strconv.ParseFloat(delta, 64)
+	if err != nil || math.IsNaN(floatDelta) || math.IsInf(floatDelta, 0) {
+		return "", fmt.Errorf("delta must be a finite number")
+	}
+	lo, hi := math.Inf(-1), math.Inf(1)
+	if minValue != "" {
+		if lo, err = strconv.ParseFloat(minValue, 64); err != nil || math.IsNaN(lo) {
+			return "", fmt.Errorf("min must be a number")
+		}
+	}
+	if maxValue != "" {
+		if hi, err = strconv.ParseFloat(maxValue, 64); err != nil || math.IsNaN(hi) {
+			return "", fmt.Errorf("max must be a number")
+		}
+	}
+	if lo > hi {
+		return "", fmt.Errorf("min must not be greater than max")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var val float64
+	if str, ok := d.stringStore[key]; ok {
+		if val, err = strconv.ParseFloat(str, 64); err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+			return "", fmt.Errorf("value is not a valid float")
+		}
+	}
+	val += floatDelta
+	if math.IsInf(val, 0) {
+		return "", fmt.Errorf("increment would overflow")
+	}
+	val = min(max(val, lo), hi)
+
+	result := strconv.FormatFloat(val, 'f', -1, 64)
+	if err := d.setString(key, result); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// Del removes keys of any type and returns how many of them existed.
+func (s *Store) Del(domain string, keys []string) (int, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := 0
+	for _, key := range keys {
+		if d.deleteKey(key) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Exists returns how many of keys exist, counting repeated keys each time.
+func (s *Store) Exists(domain string, keys []string) (int, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n := 0
+	for _, key := range keys {
+		if d.keyType(key) != "none" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Type returns "string", "skiplist" or "none" depending on what key holds.
+func (s *Store) Type(domain, key string) (string, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.keyType(key), nil
+}
+
+// Rename moves key to newKey, replacing anything newKey held.
+func (s *Store) Rename(domain, key, newKey string) error {
+	_, err := s.rename(domain, key, newKey, true)
+	return err
+}
+
+// RenameNX moves key to newKey only if newKey does not exist yet, and
+// reports whether it did.
+func (s *Store) RenameNX(domain, key, newKey string) (bool, error) {
+	return s.rename(domain, key, newKey, false)
+}
+
+func (s *Store) rename(domain, key, newKey string, replace bool) (bool, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keyType(key) == "none" {
+		return false, fmt.Errorf("key not found")
+	}
+	if key == newKey {
+		return replace, nil
+	}
+	if err := d.limits.Load().checkKey(newKey); err != nil {
+		return false, err
+	}
+	if d.keyType(newKey) != "none" {
+		if !replace {
+			return false, nil
+		}
+		d.deleteKey(newKey)
+	}
+
+	access := d.access[key]
+	if value, ok := d.stringStore[key]; ok {
+		d.deleteString(key)
+		d.putString(newKey, value)
+	}
+	if sl, ok := d.skipListStore[key]; ok {
+		d.skipListStore[newKey] = sl
+		delete(d.skipListStore, key)
+		d.skipListKeys.delete(key)
+		d.skipListKeys.insert(newKey)
+		d.charge(int64(len(newKey) - len(key)))
+	}
+	d.access[newKey] = access
+	delete(d.access, key)
+	return true, nil
+}
+
+// Copy copies key to newKey, deep-copying skip lists. If newKey exists it
+// is only overwritten when replace is set. Copy reports whether it copied.
+func (s *Store) Copy(domain, key, newKey string, replace bool) (bool, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return false, err
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keyType(key) == "none" {
+		return false, fmt.Errorf("key not found")
+	}
+	if key == newKey {
+		return false, fmt.Errorf("source and destination keys are the same")
+	}
+	if d.keyType(newKey) != "none" && !replace {
+		return false, nil
+	}
+
+	// Check the limits before touching newKey, counting only what the copy
+	// adds on top of what newKey already holds.
+	value, isString := d.stringStore[key]
+	_, isSkipList := d.skipListStore[key]
+	_, hasString := d.stringStore[newKey]
+	_, hasSkipList := d.skipListStore[newKey]
+	limits := d.limits.Load()
+	if err := limits.checkKey(newKey); err != nil {
+		return false, err
+	}
+	added := 0
+	if isString && !hasString {
+		added++
+	}
+	if isSkipList && !hasSkipList {
+		added++
+		if limits.MaxSkipLists > 0 && len(d.skipListStore) >= limits.MaxSkipLists {
+			return false, errSkipListLimit
+		}
+	}
+	if err := d.checkNewKeys(added); err != nil {
+		return false, err
+	}
+
+	var clone *SkipList
+	if sl, ok := d.skipListStore[key]; ok {
+		sl.mu.RLock()
+		clone = sl.Clone()
+		sl.mu.RUnlock()
+	}
+
+	var need int64
+	if isString {
+		need += stringSize(newKey, value)
+	}
+	if clone != nil {
+		need += skipListSize(newKey, clone)
+	}
+	// Make room before deleting newKey, so a copy that does not fit leaves
+	// newKey as it was; what newKey holds now is freed by the copy.
+	if err := d.makeRoom(need - d.keySize(newKey)); err != nil {
+		return false, err
+	}
+	d.deleteKey(newKey)
+	// If eviction took newKey, its bytes were counted as freed twice; make
+	// sure the copy still fits.
+	if err := d.makeRoom(need); err != nil {
+		return false, err
+	}
+	// Eviction may have taken the source; copy what was read anyway.
+	if isString {
+		d.putString(newKey, value)
+	}
+	if clone != nil {
+		d.putSkipList(newKey, clone)
+	}
+	return true, nil
+}
+
+func (s *Store) InsertToSkipList(domain, slkey, key, value string) error {
+	intKey, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return fmt.Errorf("key must be integer")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return err
+	}
+
+	if err := d.limits.Load().checkValue(value); err != nil {
+		return err
+	}
+	if err := d.reserve(int64(skipListInsertBytes + len(value))); err != nil {
+		return err
+	}
+	sl, err := d.lockSkipList(slkey, true)
+	if err != nil {
+		return err
+	}
+	defer sl.mu.Unlock()
+	if limit := d.limits.Load().MaxSkipListLen; limit > 0 && sl.Len() >= limit {
+		return errSkipListLenLimit
+	}
+	before := sl.bytes
 	sl.Insert(int(intKey), value)
+	d.charge(int64(sl.bytes - before))
 	return nil
 }
 
@@ -142,69 +780,93 @@ func (s *Store) DeleteFromSkipList(domain, slkey, key string) error {
 		return fmt.Errorf("key must be integer")
 	}
 
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
-	if !ok {
-		return fmt.Errorf("domain not found")
+	d, err := s.domain(domain)
+	if err != nil {
+		return err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	sl, ok := d.skipListStore[slkey]
-	if !ok {
-		return fmt.Errorf("skip list not found")
+	sl, err := d.lockSkipList(slkey, false)
+	if err != nil {
+		return err
+	}
+	if sl == nil {
+		return nil
 	}
 
+	before := sl.bytes
 	sl.Delete(int(intKey))
+	d.charge(int64(sl.bytes - before))
+	sl.mu.Unlock()
+	d.dropIfEmpty(slkey, sl)
 	return nil
 }
 
-func (s *Store) DeleteRangeFromSkipList(domain, slkey, minKey, maxKey string) error {
+// DeleteRangeFromSkipList removes the elements with minKey <= key <= maxKey
+// and returns how many were removed.
+func (s *Store) DeleteRangeFromSkipList(domain, slkey, minKey, maxKey string) (int, error) {
 	intMinKey, err := strconv.ParseInt(minKey, 10, 64)
 	if err != nil {
-		return fmt.Errorf("minKey must be integer")
+		return 0, fmt.Errorf("minKey must be integer")
 	}
 	intMaxKey, err := strconv.ParseInt(maxKey, 10, 64)
 	if err != nil {
-		return fmt.Errorf("maxKey must be integer")
+		return 0, fmt.Errorf("maxKey must be integer")
 	}
 
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
-	if !ok {
-		return fmt.Errorf("domain not found")
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	sl, ok := d.skipListStore[slkey]
-	if !ok {
-		return fmt.Errorf("skip list not found")
+	sl, err := d.lockSkipList(slkey, false)
+	if err != nil {
+		return 0, err
+	}
+	if sl == nil {
+		return 0, nil
 	}
 
-	sl.DeleteRange(int(intMinKey), int(intMaxKey))
-	return nil
+	before := sl.bytes
+	removed := sl.DeleteRange(int(intMinKey), int(intMaxKey))
+	d.charge(int64(sl.bytes - before))
+	sl.mu.Unlock()
+	d.dropIfEmpty(slkey, sl)
+	return removed, nil
 }
 
-// func (s *Store) GetAllValuesFromSkipList(domain, slkey string) ([]string, error) {
-// 	//s.mu.RLock()
-// 	d, ok := s.domains[domain]
-// 	//s.mu.RUnlock()
-// 	if !ok {
-// 		return nil, fmt.Errorf("domain not found")
-// 	}
+// DeleteRankRangeFromSkipList removes the elements whose 0-based rank lies
+// in [start, stop], negative ranks counting from the end, and returns how
+// many were removed.
+func (s *Store) DeleteRankRangeFromSkipList(domain, slkey, start, stop string) (int, error) {
+	intStart, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("start must be integer")
+	}
+	intStop, err := strconv.Atoi(stop)
+	if err != nil {
+		return 0, fmt.Errorf("stop must be integer")
+	}
+
+	d, err := s.domain(domain)
+	if err != nil {
+		return 0, err
+	}
 
-// 	d.mu.RLock()
-// 	defer d.mu.RUnlock()
-// 	sl, ok := d.skipListStore[slkey]
-// 	if !ok {
-// 		return nil, fmt.Errorf("skip list not found")
-// 	}
+	sl, err := d.lockSkipList(slkey, false)
+	if err != nil {
+		return 0, err
+	}
+	if sl == nil {
+		return 0, nil
+	}
 
-// 	return sl.GetAllValues(), nil
-// }
+	before := sl.bytes
+	removed := sl.DeleteRangeByRank(intStart, intStop)
+	d.charge(int64(sl.bytes - before))
+	sl.mu.Unlock()
+	d.dropIfEmpty(slkey, sl)
+	return removed, nil
+}
 
 func (s *Store) SearchInSkipList(domain, slkey, key string) (string, error) {
 	intKey, err := strconv.ParseInt(key, 10, 64)
@@ -212,20 +874,18 @@ func (s *Store) SearchInSkipList(domain, slkey, key string) (string, error) {
 		return "", fmt.Errorf("key must be integer")
 	}
 
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
-	if !ok {
-		return "", fmt.Errorf("domain not found")
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
 	}
 
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	sl, ok := d.skipListStore[slkey]
+	sl, ok := d.skipList(slkey)
 	if !ok {
-		return "", fmt.Errorf("skip list not found")
+		return "", fmt.Errorf("key not found")
 	}
 
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
 	value, found := sl.Search(int(intKey))
 	if !found {
 		return "", fmt.Errorf("key not found")
@@ -238,128 +898,116 @@ func (s *Store) RankInSkipList(domain, slkey, key string) (string, error) {
 		return "", fmt.Errorf("key must be integer")
 	}
 
-	//s.mu.RLock()
-	d, ok := s.domains[domain]
-	//s.mu.RUnlock()
-	if !ok {
-		return "", fmt.Errorf("domain not found")
+	d, err := s.domain(domain)
+	if err != nil {
+		return "", err
 	}
 
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	
-	sl, ok := d.skipListStore[slkey]
+	sl, ok := d.skipList(slkey)
 	if !ok {
-		return "", fmt.Errorf("skip list not found")
+		return "0", nil
 	}
 
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
 	value := sl.Rank(int(intKey))
 	return strconv.Itoa(value), nil
 }
-// WebSocket connection upgrade
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// DebugSkipList describes the structure of a skip list and checks its
+// invariants, reporting any violation in the InvariantError field.
+func (s *Store) DebugSkipList(domain, slkey string, verbose bool) (*SkipListInfo, error) {
+	d, err := s.domain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	sl, ok := d.skipList(slkey)
+	if !ok {
+		sl = NewSkipList()
+	}
+
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+	info := sl.Describe(verbose)
+	if err := sl.Validate(); err != nil {
+		info.InvariantError = err.Error()
+	}
+	return &info, nil
+}
+
+// requestKeys returns the keys a multi-key request applies to: Keys, plus
+// Key when it is set.
+func requestKeys(req Request) []string {
+	if req.Key == "" {
+		return req.Keys
+	}
+	return append(req.Keys, req.Key)
+}
+
+// boolValue encodes a boolean result as "1" or "0" for Response.Value.
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
 }
 
+// upgrader only accepts browsers on the host the page came from; a Server
+// can allow other origins with WithAllowedOrigins.
+var upgrader = websocket.Upgrader{}
+
+// HandleWebSocket serves the store's actions over websocket connections.
+//
+// It is unauthenticated: there are no tokens, client certificates, ACLs,
+// connection limits or per-connection and per-user rate limits, so any
+// client that can reach it can read and change every domain. Only the
+// limits of each domain apply. Serve the store with a Server to get the
+// rest.
+//
+// Browsers are only accepted from pages served by the same host. Earlier
+// versions accepted every origin; clients that relied on that must move to
+// a Server with WithAllowedOrigins. Clients that are not browsers send no
+// Origin header and are unaffected.
 func (s *Store) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
+		// Upgrade has replied to the client already
 		return
 	}
 	defer conn.Close()
+	conn.SetReadLimit(DefaultMaxMessageSize)
+	serveConn(conn, nil, 0, s.handleRequest)
+}
 
+// serveConn answers the requests read from conn with handle until the
+// client goes away or, when closing is not nil, until closing is set and
+// the read in progress is interrupted. With an idleTimeout, clients that
+// send nothing for that long are dropped.
+func serveConn(conn *websocket.Conn, closing *atomic.Bool, idleTimeout time.Duration, handle func(Request) Response) {
+	if idleTimeout > 0 {
+		stop := keepAlive(conn, closing, idleTimeout)
+		defer stop()
+	}
 	for {
+		if idleTimeout > 0 {
+			extendDeadline(conn, closing, idleTimeout)
+		}
+		if closing != nil && closing.Load() {
+			return
+		}
 		var req Request
 		err := conn.ReadJSON(&req)
 		if err != nil {
+			if closing != nil && closing.Load() {
+				return
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				fmt.Printf("error: %v", err)
 			}
 			break
 		}
 
-		var resp Response
-		switch req.Action {
-		case "create_domain":
-			s.CreateDomain(req.Domain)
-			resp = Response{Status: "success"}
-		case "set_string":
-			err := s.SetString(req.Domain, req.Key, req.Value)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "get_string":
-			value, err := s.GetString(req.Domain, req.Key)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success", Value: value}
-			}
-		case "insert_skiplist":
-			err := s.InsertToSkipList(req.Domain, req.SLKey, req.Key, req.Value)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "delete_skiplist":
-			err := s.DeleteFromSkipList(req.Domain, req.SLKey, req.Key)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "delete_range_skiplist":
-			err := s.DeleteRangeFromSkipList(req.Domain, req.SLKey, req.MinKey, req.MaxKey)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "rank_skiplist":
-			r, err := s.RankInSkipList(req.Domain, req.SLKey, req.Key)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success", Value: r}
-			}	
-		// case "get_all_skiplist":
-		// 	values, err := s.GetAllValuesFromSkipList(req.Domain, req.SLKey)
-		// 	if err != nil {
-		// 		resp = Response{Status: "error", Message: err.Error()}
-		// 	} else {
-		// 		resp = Response{Status: "success", Values: values}
-		// 	}
-		case "increment":
-			err := s.Increment(req.Domain, req.Key)
-			if (err != nil) {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "decrement":
-			err := s.Decrement(req.Domain, req.Key)
-			if (err != nil) {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success"}
-			}
-		case "search_skiplist":
-			value, err := s.SearchInSkipList(req.Domain, req.SLKey, req.Key)
-			if err != nil {
-				resp = Response{Status: "error", Message: err.Error()}
-			} else {
-				resp = Response{Status: "success", Value: value}
-			}
-		default:
-			resp = Response{Status: "error", Message: "unknown action"}
-		}
-
+		resp := handle(req)
 		err = conn.WriteJSON(resp)
 		if err != nil {
 			fmt.Printf("error: %v", err)
@@ -368,36 +1016,323 @@ func (s *Store) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+var errUnknownAction = errors.New("unknown action")
 
-type Server struct {
-	httpServer *http.Server
-}
-
-func StartServer(urlStr string) (*Server, error) {
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid URL: %v", err)
+// errorResponse reports err to the client. Requests over a rate limit get
+// the status "rate_limited" and how long to wait before retrying.
+func errorResponse(err error) Response {
+	var limited *RateLimitError
+	if errors.As(err, &limited) {
+		return Response{Status: "rate_limited", Message: err.Error(), RetryAfterMs: (limited.RetryAfter + time.Millisecond - 1).Milliseconds()}
 	}
+	return Response{Status: "error", Message: err.Error()}
+}
 
-	store := NewStore()
-	http.HandleFunc(u.Path, func(w http.ResponseWriter, r *http.Request) {
-		store.HandleWebSocket(w, r)
-	})
-
-	server := &http.Server{Addr: u.Host, Handler: nil}
-
-	go func() {
-		fmt.Printf("Starting server on %s...\n", u.Host)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("ListenAndServe(): %v", err)
+// handleRequest performs the action of one request.
+func (s *Store) handleRequest(req Request) Response {
+	var resp Response
+	switch req.Action {
+	case "create_domain":
+		var err error
+		if req.Limits != nil {
+			err = s.CreateDomainWithLimits(req.Domain, *req.Limits)
+		} else {
+			s.CreateDomain(req.Domain)
+		}
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "clone_domain":
+		err := s.CloneDomain(req.Domain, req.NewDomain)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "export_domain":
+		var buf strings.Builder
+		err := s.ExportDomain(req.Domain, &limitedWriter{w: &buf, n: DefaultMaxMessageSize})
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: buf.String()}
+		}
+	case "import_domain":
+		n, err := s.ImportDomain(req.Domain, strings.NewReader(req.Value), ImportMode(req.Mode))
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "set_limits":
+		var err error
+		if req.Limits == nil {
+			err = fmt.Errorf("limits are required")
+		} else {
+			err = s.SetLimits(req.Domain, *req.Limits)
 		}
-	}()
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "get_limits":
+		limits, err := s.Limits(req.Domain)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Limits: limits}
+		}
+	case "config_memory":
+		err := s.ConfigureMemory(req.Domain, req.MaxMemory, req.Policy)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "memory_stats":
+		stats, err := s.MemoryStats(req.Domain)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Memory: stats}
+		}
+	case "set_string":
+		err := s.SetString(req.Domain, req.Key, req.Value)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "get_string":
+		value, err := s.GetString(req.Domain, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "append":
+		n, err := s.Append(req.Domain, req.Key, req.Value)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "getrange":
+		value, err := s.GetRange(req.Domain, req.Key, req.Start, req.Stop)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "setrange":
+		n, err := s.SetRange(req.Domain, req.Key, req.Offset, req.Value)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "strlen":
+		n, err := s.StrLen(req.Domain, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "getset":
+		value, found, err := s.GetSet(req.Domain, req.Key, req.Value)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value, Found: []bool{found}}
+		}
+	case "getdel":
+		value, err := s.GetDel(req.Domain, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "del":
+		n, err := s.Del(req.Domain, requestKeys(req))
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "exists":
+		n, err := s.Exists(req.Domain, requestKeys(req))
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "type":
+		t, err := s.Type(req.Domain, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: t}
+		}
+	case "rename":
+		err := s.Rename(req.Domain, req.Key, req.NewKey)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "renamenx":
+		renamed, err := s.RenameNX(req.Domain, req.Key, req.NewKey)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: boolValue(renamed)}
+		}
+	case "copy":
+		copied, err := s.Copy(req.Domain, req.Key, req.NewKey, req.Replace)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: boolValue(copied)}
+		}
+	case "scan":
+		keys, cursor, err := s.Scan(req.Domain, req.Cursor, req.Match, req.Type, req.Count)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Keys: keys, Cursor: cursor}
+		}
+	case "scan_prefix":
+		keys, values, cursor, err := s.ScanPrefix(req.Domain, req.Prefix, req.Cursor, req.Count)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Keys: keys, Values: values, Cursor: cursor}
+		}
+	case "scan_range":
+		keys, values, cursor, err := s.ScanRange(req.Domain, req.MinKey, req.MaxKey, req.Cursor, req.Count)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Keys: keys, Values: values, Cursor: cursor}
+		}
+	case "mget":
+		values, found, err := s.MGet(req.Domain, req.Keys)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Values: values, Found: found}
+		}
+	case "mset":
+		err := s.MSet(req.Domain, req.Keys, req.Values)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "msetnx":
+		set, err := s.MSetNX(req.Domain, req.Keys, req.Values)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: boolValue(set)}
+		}
+	case "insert_skiplist":
+		err := s.InsertToSkipList(req.Domain, req.SLKey, req.Key, req.Value)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "delete_skiplist":
+		err := s.DeleteFromSkipList(req.Domain, req.SLKey, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success"}
+		}
+	case "delete_range_skiplist":
+		n, err := s.DeleteRangeFromSkipList(req.Domain, req.SLKey, req.MinKey, req.MaxKey)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "delete_rank_range_skiplist":
+		n, err := s.DeleteRankRangeFromSkipList(req.Domain, req.SLKey, req.Start, req.Stop)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: strconv.Itoa(n)}
+		}
+	case "rank_skiplist":
+		r, err := s.RankInSkipList(req.Domain, req.SLKey, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: r}
+		}	
+	// case "get_all_skiplist":
+	// 	values, err := s.GetAllValuesFromSkipList(req.Domain, req.SLKey)
+	// 	if err != nil {
+	// 		resp = errorResponse(err)
+	// 	} else {
+	// 		resp = Response{Status: "success", Values: values}
+	// 	}
+	case "increment":
+		value, err := s.Increment(req.Domain, req.Key)
+		if (err != nil) {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "decrement":
+		value, err := s.Decrement(req.Domain, req.Key)
+		if (err != nil) {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "incrby":
+		value, err := s.IncrBy(req.Domain, req.Key, req.Delta, req.Min, req.Max)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "decrby":
+		value, err := s.DecrBy(req.Domain, req.Key, req.Delta, req.Min, req.Max)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "incrbyfloat":
+		value, err := s.IncrByFloat(req.Domain, req.Key, req.Delta, req.Min, req.Max)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	case "debug_skiplist":
+		info, err := s.DebugSkipList(req.Domain, req.SLKey, req.Verbose)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", SkipList: info}
+		}
+	case "search_skiplist":
+		value, err := s.SearchInSkipList(req.Domain, req.SLKey, req.Key)
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = Response{Status: "success", Value: value}
+		}
+	default:
+		resp = errorResponse(errUnknownAction)
+	}
 
-	return &Server{httpServer: server}, nil
+	return resp
 }
-
-func (s *Server) CloseServer() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	return s.httpServer.Shutdown(ctx)
-}
\ No newline at end of file
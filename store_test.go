@@ -147,6 +147,7 @@ func TestWebSocketStore(t *testing.T) {
 	var deleteRangeSkipListResponse Response
 	conn.ReadJSON(&deleteRangeSkipListResponse)
 	assert.Equal(t, "success", deleteRangeSkipListResponse.Status)
+	assert.Equal(t, "2", deleteRangeSkipListResponse.Value)
 
 	// Confirm Range Deletion from SkipList
 	searchSkipListRequest3 := Request{
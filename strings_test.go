@@ -0,0 +1,213 @@
+package kvs
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketMultiKey(t *testing.T) {
+	store := NewStore()
+	server := httptest.NewServer(http.HandlerFunc(store.HandleWebSocket))
+	defer server.Close()
+
+	url := "ws" + server.URL[4:]
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.WriteJSON(Request{Action: "create_domain", Domain: "test_domain"})
+	var createDomainResponse Response
+	conn.ReadJSON(&createDomainResponse)
+	assert.Equal(t, "success", createDomainResponse.Status)
+
+	// MSet
+	msetRequest := Request{
+		Action: "mset",
+		Domain: "test_domain",
+		Keys:   []string{"a", "b"},
+		Values: []string{"1", "2"},
+	}
+	conn.WriteJSON(msetRequest)
+	var msetResponse Response
+	conn.ReadJSON(&msetResponse)
+	assert.Equal(t, "success", msetResponse.Status)
+
+	// MSet with mismatched lengths
+	msetRequest.Values = []string{"1"}
+	conn.WriteJSON(msetRequest)
+	var msetErrorResponse Response
+	conn.ReadJSON(&msetErrorResponse)
+	assert.Equal(t, "error", msetErrorResponse.Status)
+
+	// MSetNX touching an existing key sets nothing
+	msetnxRequest := Request{
+		Action: "msetnx",
+		Domain: "test_domain",
+		Keys:   []string{"b", "c"},
+		Values: []string{"20", "30"},
+	}
+	conn.WriteJSON(msetnxRequest)
+	var msetnxResponse Response
+	conn.ReadJSON(&msetnxResponse)
+	assert.Equal(t, "success", msetnxResponse.Status)
+	assert.Equal(t, "0", msetnxResponse.Value)
+
+	// MSetNX with only new keys
+	msetnxRequest.Keys = []string{"c", "d"}
+	conn.WriteJSON(msetnxRequest)
+	var msetnxResponse2 Response
+	conn.ReadJSON(&msetnxResponse2)
+	assert.Equal(t, "success", msetnxResponse2.Status)
+	assert.Equal(t, "1", msetnxResponse2.Value)
+
+	// MGet
+	mgetRequest := Request{
+		Action: "mget",
+		Domain: "test_domain",
+		Keys:   []string{"a", "b", "c", "d", "e"},
+	}
+	conn.WriteJSON(mgetRequest)
+	var mgetResponse Response
+	conn.ReadJSON(&mgetResponse)
+	assert.Equal(t, "success", mgetResponse.Status)
+	assert.Equal(t, []string{"1", "2", "20", "30", ""}, mgetResponse.Values)
+	assert.Equal(t, []bool{true, true, true, true, false}, mgetResponse.Found)
+}
+
+func TestCounters(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+
+	// Missing keys start at zero
+	value, err := store.Increment("test_domain", "hits")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	value, err = store.IncrBy("test_domain", "hits", "41", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", value)
+
+	value, err = store.DecrBy("test_domain", "hits", "50", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "-8", value)
+
+	// Clamping
+	value, err = store.IncrBy("test_domain", "hits", "100", "", "10")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+
+	value, err = store.DecrBy("test_domain", "hits", "100", "0", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", value)
+
+	// Overflow leaves the value untouched
+	assert.NoError(t, store.SetString("test_domain", "big", "9223372036854775806"))
+	_, err = store.IncrBy("test_domain", "big", "2", "", "")
+	assert.EqualError(t, err, "increment or decrement would overflow")
+	_, err = store.DecrBy("test_domain", "big", "-9223372036854775808", "", "")
+	assert.EqualError(t, err, "increment or decrement would overflow")
+	value, err = store.GetString("test_domain", "big")
+	assert.NoError(t, err)
+	assert.Equal(t, "9223372036854775806", value)
+
+	// Non-integer values and deltas
+	assert.NoError(t, store.SetString("test_domain", "name", "kvs"))
+	_, err = store.Decrement("test_domain", "name")
+	assert.EqualError(t, err, "value is not an integer")
+	_, err = store.IncrBy("test_domain", "hits", "1.5", "", "")
+	assert.EqualError(t, err, "delta must be integer")
+
+	// Floats
+	value, err = store.IncrByFloat("test_domain", "price", "10.5", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.5", value)
+
+	value, err = store.IncrByFloat("test_domain", "price", "-0.25", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.25", value)
+
+	value, err = store.IncrByFloat("test_domain", "price", "5", "", "12")
+	assert.NoError(t, err)
+	assert.Equal(t, "12", value)
+
+	_, err = store.IncrByFloat("test_domain", "price", "1e308", "", "")
+	assert.NoError(t, err)
+	_, err = store.IncrByFloat("test_domain", "price", "1e308", "", "")
+	assert.EqualError(t, err, "increment would overflow")
+}
+
+func TestStringManipulation(t *testing.T) {
+	store := NewStore()
+	store.CreateDomain("test_domain")
+
+	n, err := store.Append("test_domain", "log", "Hello")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	n, err = store.Append("test_domain", "log", " World")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+
+	tests := []struct {
+		start, end string
+		expected   string
+	}{
+		{"0", "4", "Hello"},
+		{"-5", "-1", "World"},
+		{"0", "-1", "Hello World"},
+		{"6", "100", "World"},
+		{"5", "2", ""},
+		{"-100", "0", "H"},
+	}
+	for _, test := range tests {
+		value, err := store.GetRange("test_domain", "log", test.start, test.end)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, value, "GetRange(%s, %s)", test.start, test.end)
+	}
+
+	n, err = store.SetRange("test_domain", "log", "6", "Redis")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	value, _ := store.GetString("test_domain", "log")
+	assert.Equal(t, "Hello Redis", value)
+
+	n, err = store.SetRange("test_domain", "padded", "3", "x")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	value, _ = store.GetString("test_domain", "padded")
+	assert.Equal(t, "\x00\x00\x00x", value)
+
+	_, err = store.SetRange("test_domain", "log", "-1", "x")
+	assert.EqualError(t, err, "offset must be a non-negative integer")
+	_, err = store.SetRange("test_domain", "log", strconv.Itoa(math.MaxInt64), "x")
+	assert.EqualError(t, err, "string exceeds maximum allowed size")
+
+	n, err = store.StrLen("test_domain", "log")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	n, err = store.StrLen("test_domain", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	old, found, err := store.GetSet("test_domain", "token", "a")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, "", old)
+	old, found, err = store.GetSet("test_domain", "token", "b")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "a", old)
+
+	value, err = store.GetDel("test_domain", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", value)
+	_, err = store.GetDel("test_domain", "token")
+	assert.EqualError(t, err, "key not found")
+	_, err = store.GetString("test_domain", "token")
+	assert.EqualError(t, err, "key not found")
+}
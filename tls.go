@@ -0,0 +1,125 @@
+package kvs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most, while handshakes are coming in.
+var certCheckInterval = 10 * time.Second
+
+// certReloader serves the server certificate and the client CA pool from
+// files, picking up new versions of the files without a restart.
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+
+	mu       sync.Mutex
+	config   *tls.Config
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func newCertReloader(certFile, keyFile, caFile string, clientAuth tls.ClientAuthType) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, clientAuth: clientAuth}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	if r.caFile == "" {
+		return []string{r.certFile, r.keyFile}
+	}
+	return []string{r.certFile, r.keyFile, r.caFile}
+}
+
+// reload reads the files again. On error the previous configuration stays
+// in use.
+func (r *certReloader) reload() error {
+	modTimes := r.modTimesNow()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = r.clientAuth
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = config
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *certReloader) modTimesNow() []time.Time {
+	var modTimes []time.Time
+	for _, file := range r.files() {
+		var modTime time.Time
+		if info, err := os.Stat(file); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes = append(modTimes, modTime)
+	}
+	return modTimes
+}
+
+// getConfigForClient is the tls.Config.GetConfigForClient hook. It reloads
+// the files when they changed since they were last loaded.
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	check := time.Since(r.checked) >= certCheckInterval
+	if check {
+		r.checked = time.Now()
+	}
+	loaded := r.modTimes
+	r.mu.Unlock()
+
+	if check {
+		for i, modTime := range r.modTimesNow() {
+			if !modTime.Equal(loaded[i]) {
+				if err := r.reload(); err != nil {
+					log.Printf("tls: keeping the current certificate: %v", err)
+				}
+				break
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.config, nil
+}
+
+// ClientIdentity returns the common name of the verified client
+// certificate of r, or "" if the client presented none.
+func ClientIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,123 @@
+package kvs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes name.crt and name.key to dir, for a certificate with the
+// given common name signed by parent, or self-signed if parent is nil.
+func writeCert(t *testing.T, dir, name, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	assert.NoError(t, err)
+	serial, err := crand.Int(crand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(crand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(dir+"/"+name+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(dir+"/"+name+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", "test CA", nil, nil)
+	writeCert(t, dir, "server", "server1", ca, caKey)
+	clientCert, _ := writeCert(t, dir, "client", "alice", ca, caKey)
+
+	server, err := StartServer("wss://127.0.0.1:0/kvs",
+		WithTLS(dir+"/server.crt", dir+"/server.key"),
+		WithClientCA(dir+"/ca.crt", true))
+	assert.NoError(t, err)
+	defer server.CloseServer()
+	server.Store().CreateDomain("test_domain")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client, err := tls.LoadX509KeyPair(dir+"/client.crt", dir+"/client.key")
+	assert.NoError(t, err)
+	// dial connects and returns the common name of the server certificate.
+	dial := func(certs ...tls.Certificate) (string, error) {
+		dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}
+		conn, _, err := dialer.Dial("wss://"+server.Addr().String()+"/kvs", nil)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		if err := conn.WriteJSON(Request{Action: "set_string", Domain: "test_domain", Key: "k", Value: "v"}); err != nil {
+			return "", err
+		}
+		var resp Response
+		if err := conn.ReadJSON(&resp); err != nil {
+			return "", err
+		}
+		assert.Equal(t, "success", resp.Status)
+		return conn.UnderlyingConn().(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	cn, err := dial(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "server1", cn)
+	_, err = dial()
+	assert.Error(t, err, "client certificate is required")
+
+	// The client certificate names the client
+	r := httptest.NewRequest("GET", "/kvs", nil)
+	assert.Equal(t, "", ClientIdentity(r))
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert, ca}}}
+	assert.Equal(t, "alice", ClientIdentity(r))
+
+	// Certificates are reloaded on request
+	writeCert(t, dir, "server", "server2", ca, caKey)
+	assert.NoError(t, server.ReloadTLS())
+	cn, _ = dial(client)
+	assert.Equal(t, "server2", cn)
+
+	// and when the files change
+	defer func(interval time.Duration) { certCheckInterval = interval }(certCheckInterval)
+	certCheckInterval = 0
+	writeCert(t, dir, "server", "server3", ca, caKey)
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(dir+"/server.crt", later, later))
+	cn, _ = dial(client)
+	assert.Equal(t, "server3", cn)
+
+	// A broken file keeps the current certificate
+	assert.NoError(t, os.WriteFile(dir+"/server.key", []byte("garbage"), 0o600))
+	assert.Error(t, server.ReloadTLS())
+	cn, _ = dial(client)
+	assert.Equal(t, "server3", cn)
+}